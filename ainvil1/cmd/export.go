@@ -1,13 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"time"
 
 	"github.com/sottey/ainvil/internal/storage"
 	"github.com/sottey/ainvil/lib/api"
-	"github.com/sottey/ainvil/lib/model"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -34,29 +36,35 @@ var exportCmd = &cobra.Command{
 			log.Fatalf("Failed to initialize API client: %v", err)
 		}
 
-		var entries []model.Entry
-
-		if all {
-			entries, err = client.GetAllEntries()
-		} else {
+		var start, end time.Time
+		if !all {
 			if startDate == "" || endDate == "" {
 				log.Fatal("Must provide both --start and --end (or use --all)")
 			}
-			entries, err = client.GetEntries(startDate, endDate)
+			if start, err = time.Parse("2006-01-02", startDate); err != nil {
+				log.Fatalf("Invalid --start: %v", err)
+			}
+			if end, err = time.Parse("2006-01-02", endDate); err != nil {
+				log.Fatalf("Invalid --end: %v", err)
+			}
+			end = end.AddDate(0, 0, 1)
 		}
 
-		if err != nil {
-			log.Fatalf("Failed to get entries: %v", err)
-		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
 
-		for _, entry := range entries {
-			err := storage.SaveEntry(entry, full)
+		count := 0
+		for entry, err := range client.Entries(ctx, start, end) {
 			if err != nil {
+				log.Fatalf("Failed to get entries: %v", err)
+			}
+			count++
+			if err := storage.SaveEntry(entry, full); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to save entry %s: %v\n", entry.ID, err)
 			}
 		}
 
-		fmt.Printf("Export complete. %d entries processed.\n", len(entries))
+		fmt.Printf("Export complete. %d entries processed.\n", count)
 	},
 }
 
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -10,7 +11,8 @@ import (
 )
 
 // SaveEntry writes an Entry to ./export/YYYY/MM/DD/{entry.ID}.json
-// If overwrite is false and the file exists, it skips saving.
+// If overwrite is false and the file exists, it skips saving. If overwrite is
+// true but the file already holds exactly this entry, it is left untouched.
 func SaveEntry(entry model.Entry, overwrite bool) error {
 	t := entry.Timestamp
 	dir := filepath.Join("export", t.Format("2006"), t.Format("01"), t.Format("02"))
@@ -32,6 +34,10 @@ func SaveEntry(entry model.Entry, overwrite bool) error {
 		return fmt.Errorf("failed to marshal entry: %w", err)
 	}
 
+	if existing, err := os.ReadFile(filename); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
 	if err := os.WriteFile(filename, data, 0644); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
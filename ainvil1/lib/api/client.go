@@ -1,6 +1,10 @@
 package api
 
 import (
+	"context"
+	"iter"
+	"time"
+
 	"github.com/sottey/ainvil/lib/model"
 )
 
@@ -9,10 +13,8 @@ type APIClient interface {
 	// Name returns the unique identifier of the API (e.g., "omi", "limitless")
 	Name() string
 
-	// GetEntries fetches entries between the given date range (inclusive).
-	// Dates are in the format "YYYY-MM-DD".
-	GetEntries(startDate, endDate string) ([]model.Entry, error)
-
-	// GetAllEntries fetches all entries available from the API.
-	GetAllEntries() ([]model.Entry, error)
+	// Entries streams the entries that started in [start, end), one page
+	// at a time. A zero start or end leaves that side open. Iteration ends
+	// at the first error or when ctx is cancelled.
+	Entries(ctx context.Context, start, end time.Time) iter.Seq2[model.Entry, error]
 }
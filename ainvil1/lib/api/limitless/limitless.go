@@ -1,9 +1,11 @@
 package limitless
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"iter"
 	"net/http"
 	"net/url"
 	"time"
@@ -12,101 +14,121 @@ import (
 	"github.com/sottey/ainvil/lib/model"
 )
 
-const baseURL = "https://api.limitless.ai/v1/lifelogs"
+const (
+	// DefaultBaseURL is the Limitless lifelogs endpoint.
+	DefaultBaseURL = "https://api.limitless.ai/v1/lifelogs"
+	requestTimeout = 30 * time.Second
+)
 
 type Client struct {
-	token string
+	token      string
+	baseURL    string
+	httpClient *http.Client
 }
 
 func NewClient(token string) clientiface.APIClient {
-	return &Client{token: token}
+	return NewClientWithURL(token, DefaultBaseURL, nil)
+}
+
+// NewClientWithURL returns a client for the lifelogs endpoint at baseURL,
+// such as a local stand-in. A nil httpClient uses one with a 30 second
+// timeout.
+func NewClientWithURL(token, baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	return &Client{token: token, baseURL: baseURL, httpClient: httpClient}
 }
 
 func (c *Client) Name() string {
 	return "limitless"
 }
 
-func (c *Client) GetEntries(startDate, endDate string) ([]model.Entry, error) {
-	var all []model.Entry
-	cursor := ""
+type page struct {
+	Data struct {
+		Lifelogs []struct {
+			ID        string `json:"id"`
+			Markdown  string `json:"markdown"`
+			StartTime string `json:"startTime"`
+			Title     string `json:"title"`
+		} `json:"lifelogs"`
+	} `json:"data"`
+	Meta struct {
+		Lifelogs struct {
+			NextCursor string `json:"nextCursor"`
+		} `json:"lifelogs"`
+	} `json:"meta"`
+}
 
-	for {
-		reqURL, err := url.Parse(baseURL)
-		if err != nil {
-			return nil, fmt.Errorf("invalid URL: %w", err)
+// Entries streams the lifelogs started in [start, end), following the
+// cursor from page to page. A zero start or end is left out of the query.
+func (c *Client) Entries(ctx context.Context, start, end time.Time) iter.Seq2[model.Entry, error] {
+	return func(yield func(model.Entry, error) bool) {
+		q := url.Values{}
+		q.Set("timezone", "UTC")
+		if !start.IsZero() {
+			q.Set("start", start.UTC().Format(time.DateTime))
+		}
+		if !end.IsZero() {
+			q.Set("end", end.UTC().Format(time.DateTime))
 		}
-
-		q := reqURL.Query()
-		q.Set("start", startDate)
-		q.Set("end", endDate)
 		q.Set("includeMarkdown", "true")
 		q.Set("includeHeadings", "true")
 		q.Set("limit", "25")
-		if cursor != "" {
-			q.Set("cursor", cursor)
-		}
-		reqURL.RawQuery = q.Encode()
-
-		req, err := http.NewRequest("GET", reqURL.String(), nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("X-API-Key", c.token)
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			return nil, fmt.Errorf("limitless API error (%d): %s", resp.StatusCode, string(body))
-		}
-
-		var parsed struct {
-			Data struct {
-				Lifelogs []struct {
-					ID        string `json:"id"`
-					Markdown  string `json:"markdown"`
-					StartTime string `json:"startTime"`
-					Title     string `json:"title"`
-				} `json:"lifelogs"`
-			} `json:"data"`
-			Meta struct {
-				Lifelogs struct {
-					NextCursor string `json:"nextCursor"`
-				} `json:"lifelogs"`
-			} `json:"meta"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-			return nil, err
+		for {
+			parsed, err := c.fetchPage(ctx, q)
+			if err != nil {
+				yield(model.Entry{}, err)
+				return
+			}
+
+			for _, l := range parsed.Data.Lifelogs {
+				t, _ := time.Parse(time.RFC3339, l.StartTime)
+				entry := model.Entry{
+					ID:        l.ID,
+					Source:    "limitless",
+					Timestamp: t,
+					Content:   l.Markdown,
+					Metadata: map[string]string{
+						"title": l.Title,
+					},
+				}
+				if !yield(entry, nil) {
+					return
+				}
+			}
+
+			cursor := parsed.Meta.Lifelogs.NextCursor
+			if cursor == "" || len(parsed.Data.Lifelogs) == 0 {
+				return
+			}
+			q.Set("cursor", cursor)
 		}
+	}
+}
 
-		for _, l := range parsed.Data.Lifelogs {
-			t, _ := time.Parse(time.RFC3339, l.StartTime)
-			all = append(all, model.Entry{
-				ID:        l.ID,
-				Source:    "limitless",
-				Timestamp: t,
-				Content:   l.Markdown,
-				Metadata: map[string]string{
-					"title": l.Title,
-				},
-			})
-		}
+func (c *Client) fetchPage(ctx context.Context, q url.Values) (*page, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", c.token)
 
-		cursor = parsed.Meta.Lifelogs.NextCursor
-		if cursor == "" {
-			break
-		}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	return all, nil
-}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("limitless API error (%d): %s", resp.StatusCode, string(body))
+	}
 
-func (c *Client) GetAllEntries() ([]model.Entry, error) {
-	// Pass a very wide date range — adjust as needed
-	return c.GetEntries("2000-01-01", time.Now().Format("2006-01-02"))
+	var parsed page
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
 }
@@ -0,0 +1,125 @@
+package limitless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLifelogs serves n lifelogs three to a page, linked by cursors that
+// hold the offset of the next page, and records the queries it received.
+func fakeLifelogs(t *testing.T, n int) (*httptest.Server, *[]string) {
+	t.Helper()
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "test-token" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+
+		var resp page
+		for i := offset; i < min(offset+3, n); i++ {
+			resp.Data.Lifelogs = append(resp.Data.Lifelogs, struct {
+				ID        string `json:"id"`
+				Markdown  string `json:"markdown"`
+				StartTime string `json:"startTime"`
+				Title     string `json:"title"`
+			}{
+				ID:        fmt.Sprintf("l%d", i),
+				Markdown:  "# Lifelog",
+				StartTime: time.Date(2025, 6, 1+i, 9, 0, 0, 0, time.UTC).Format(time.RFC3339),
+				Title:     "Lifelog",
+			})
+		}
+		if offset+3 < n {
+			resp.Meta.Lifelogs.NextCursor = strconv.Itoa(offset + 3)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &queries
+}
+
+func TestEntriesFollowsCursor(t *testing.T) {
+	srv, queries := fakeLifelogs(t, 7)
+	c := NewClientWithURL("test-token", srv.URL, nil)
+
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var ids []string
+	for e, err := range c.Entries(context.Background(), start, start.AddDate(0, 1, 0)) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if fmt.Sprint(ids) != "[l0 l1 l2 l3 l4 l5 l6]" {
+		t.Errorf("got %v", ids)
+	}
+	if len(*queries) != 3 {
+		t.Fatalf("got %d requests, want 3", len(*queries))
+	}
+	for _, want := range []string{"start=2025-06-01+00%3A00%3A00", "end=2025-07-01+00%3A00%3A00", "cursor=6"} {
+		if !strings.Contains((*queries)[2], want) {
+			t.Errorf("last query %q lacks %s", (*queries)[2], want)
+		}
+	}
+}
+
+func TestEntriesStops(t *testing.T) {
+	srv, queries := fakeLifelogs(t, 30)
+	c := NewClientWithURL("test-token", srv.URL, nil)
+
+	n := 0
+	for _, err := range c.Entries(context.Background(), time.Time{}, time.Time{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n == 4 {
+			break
+		}
+	}
+	if len(*queries) != 2 {
+		t.Errorf("got %d requests after the consumer stopped on the second page", len(*queries))
+	}
+	if strings.Contains((*queries)[0], "start=") || strings.Contains((*queries)[0], "end=") {
+		t.Errorf("open range sent %q", (*queries)[0])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n = 0
+	var last error
+	for _, err := range c.Entries(ctx, time.Time{}, time.Time{}) {
+		if err != nil {
+			last = err
+			continue
+		}
+		if n++; n == 3 {
+			cancel()
+		}
+	}
+	if !errors.Is(last, context.Canceled) || n != 3 {
+		t.Errorf("after cancelling got %d entries and %v", n, last)
+	}
+
+	_, err := first(NewClientWithURL("wrong", srv.URL, nil))
+	if err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+}
+
+func first(c *Client) (string, error) {
+	for e, err := range c.Entries(context.Background(), time.Time{}, time.Time{}) {
+		return e.ID, err
+	}
+	return "", nil
+}
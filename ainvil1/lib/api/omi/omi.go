@@ -1,44 +1,185 @@
 package omi
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"iter"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sottey/ainvil/lib/clientiface"
 	"github.com/sottey/ainvil/lib/model"
 )
 
+const (
+	// DefaultBaseURL is the Omi developer API.
+	DefaultBaseURL = "https://api.omi.me/v1/dev"
+	pageSize       = 25
+	requestTimeout = 30 * time.Second
+)
+
 type Client struct {
-	token string
+	token      string
+	baseURL    string
+	httpClient *http.Client
 }
 
 func NewClient(token string) clientiface.APIClient {
-	return &Client{token: token}
+	return NewClientWithURL(token, DefaultBaseURL, nil)
+}
+
+// NewClientWithURL returns a client for the Omi API at baseURL, such as a
+// local stand-in. A nil httpClient uses one with a 30 second timeout.
+func NewClientWithURL(token, baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	return &Client{token: token, baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
 }
 
 func (c *Client) Name() string {
 	return "omi"
 }
 
-func (c *Client) GetEntries(startDate, endDate string) ([]model.Entry, error) {
-	// TODO: Replace this stub with real Omi API calls
-	start, _ := time.Parse("2006-01-02", startDate)
-	end, _ := time.Parse("2006-01-02", endDate)
+type conversation struct {
+	ID         string `json:"id"`
+	CreatedAt  string `json:"created_at"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	Source     string `json:"source"`
+	Discarded  bool   `json:"discarded"`
+	Structured struct {
+		Title       string `json:"title"`
+		Overview    string `json:"overview"`
+		Category    string `json:"category"`
+		ActionItems []struct {
+			Description string `json:"description"`
+			Completed   bool   `json:"completed"`
+		} `json:"action_items"`
+	} `json:"structured"`
+	TranscriptSegments []struct {
+		Text    string `json:"text"`
+		Speaker string `json:"speaker"`
+		IsUser  bool   `json:"is_user"`
+	} `json:"transcript_segments"`
+}
+
+// Entries streams the conversations started in [start, end). A zero start
+// or end leaves that side open. Conversations come back newest first, so
+// paging stops at the first one older than start. Conversations whose start
+// time cannot be read are skipped with a warning; they neither end paging
+// nor fall in any range.
+func (c *Client) Entries(ctx context.Context, start, end time.Time) iter.Seq2[model.Entry, error] {
+	return func(yield func(model.Entry, error) bool) {
+		for offset := 0; ; offset += pageSize {
+			page, err := c.fetchPage(ctx, offset)
+			if err != nil {
+				yield(model.Entry{}, err)
+				return
+			}
 
-	var entries []model.Entry
-	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
-		entries = append(entries, model.Entry{
-			ID:        fmt.Sprintf("omi-%s", d.Format("20060102")),
-			Source:    "omi",
-			Timestamp: d,
-			Content:   fmt.Sprintf("Simulated Omi log for %s", d.Format("Jan 2 2006")),
-		})
+			for _, conv := range page {
+				if conv.Discarded {
+					continue
+				}
+				ts := conv.StartedAt
+				if ts == "" {
+					ts = conv.CreatedAt
+				}
+				t, err := time.Parse(time.RFC3339, ts)
+				if err != nil {
+					log.Printf("omi: skipping conversation %s: unreadable start time %q", conv.ID, ts)
+					continue
+				}
+				if !end.IsZero() && !t.Before(end) {
+					continue
+				}
+				if t.Before(start) {
+					return
+				}
+				if !yield(toEntry(conv, t), nil) {
+					return
+				}
+			}
+
+			if len(page) < pageSize {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) fetchPage(ctx context.Context, offset int) ([]conversation, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(pageSize))
+	q.Set("offset", strconv.Itoa(offset))
+	q.Set("include_transcript", "true")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/user/conversations?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
 
-	return entries, nil
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("omi API error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var page []conversation
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	return page, nil
 }
 
-func (c *Client) GetAllEntries() ([]model.Entry, error) {
-	// TODO: Make paginated API calls to retrieve all logs
-	return c.GetEntries("2025-06-01", "2025-06-03")
+func toEntry(conv conversation, t time.Time) model.Entry {
+	var b strings.Builder
+	for _, seg := range conv.TranscriptSegments {
+		speaker := seg.Speaker
+		if seg.IsUser {
+			speaker = "You"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, strings.TrimSpace(seg.Text))
+	}
+
+	var tags []string
+	if conv.Structured.Category != "" {
+		tags = append(tags, conv.Structured.Category)
+	}
+
+	metadata := map[string]string{
+		"title":      conv.Structured.Title,
+		"overview":   conv.Structured.Overview,
+		"finishedAt": conv.FinishedAt,
+		"device":     conv.Source,
+	}
+	for i, item := range conv.Structured.ActionItems {
+		box := "[ ]"
+		if item.Completed {
+			box = "[x]"
+		}
+		metadata[fmt.Sprintf("actionItem%d", i+1)] = box + " " + item.Description
+	}
+
+	return model.Entry{
+		ID:        conv.ID,
+		Source:    "omi",
+		Timestamp: t,
+		Content:   b.String(),
+		Tags:      tags,
+		Metadata:  metadata,
+	}
 }
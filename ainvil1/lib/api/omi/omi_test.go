@@ -0,0 +1,184 @@
+package omi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sottey/ainvil/lib/model"
+)
+
+// fakeOmi serves convs, newest first, as the conversations endpoint does,
+// and counts the pages requested.
+func fakeOmi(t *testing.T, convs []map[string]any) (*httptest.Server, *int) {
+	t.Helper()
+	pages := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/conversations" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pages++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page := []map[string]any{}
+		if offset < len(convs) {
+			page = convs[offset:min(offset+limit, len(convs))]
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &pages
+}
+
+// conversations returns n conversations, one per day going back from
+// June 30, 2025, newest first.
+func conversations(n int) []map[string]any {
+	convs := make([]map[string]any, n)
+	for i := range convs {
+		started := time.Date(2025, 6, 30-i, 9, 0, 0, 0, time.UTC)
+		convs[i] = map[string]any{
+			"id":         fmt.Sprintf("c%02d", i),
+			"started_at": started.Format(time.RFC3339),
+			"structured": map[string]any{"title": fmt.Sprintf("Day %d", 30-i), "category": "work"},
+			"transcript_segments": []map[string]any{
+				{"text": "Hello ", "speaker": "SPEAKER_00", "is_user": true},
+				{"text": "Hi", "speaker": "SPEAKER_01"},
+			},
+		}
+	}
+	return convs
+}
+
+func day(d int) time.Time {
+	return time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC)
+}
+
+func collect(entries iter.Seq2[model.Entry, error]) ([]model.Entry, error) {
+	var all []model.Entry
+	for e, err := range entries {
+		if err != nil {
+			return all, err
+		}
+		all = append(all, e)
+	}
+	return all, nil
+}
+
+func TestEntriesPagesUntilStart(t *testing.T) {
+	srv, pages := fakeOmi(t, conversations(29))
+	c := NewClientWithURL("test-token", srv.URL+"/", nil)
+
+	entries, err := collect(c.Entries(context.Background(), day(25), day(29)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 || entries[0].ID != "c02" || entries[3].ID != "c05" {
+		t.Fatalf("got %d entries: %+v", len(entries), entries)
+	}
+	if *pages != 1 {
+		t.Errorf("fetched %d pages, want to stop after the first", *pages)
+	}
+
+	e := entries[0]
+	if e.Source != "omi" || e.Content != "You: Hello\nSPEAKER_01: Hi\n" || e.Metadata["title"] != "Day 28" || len(e.Tags) != 1 {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestEntriesWithoutRange(t *testing.T) {
+	convs := conversations(60)
+	convs[3]["discarded"] = true
+	srv, pages := fakeOmi(t, convs)
+
+	entries, err := collect(NewClientWithURL("test-token", srv.URL, nil).Entries(context.Background(), time.Time{}, time.Time{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 59 {
+		t.Errorf("got %d entries, want 59", len(entries))
+	}
+	if *pages != 3 {
+		t.Errorf("fetched %d pages, want 3", *pages)
+	}
+}
+
+func TestEntriesSkipsUnreadableTimes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(nil) })
+
+	convs := conversations(5)
+	convs[1]["started_at"] = ""
+	convs[2]["started_at"] = "yesterday"
+	srv, _ := fakeOmi(t, convs)
+
+	entries, err := collect(NewClientWithURL("test-token", srv.URL, nil).Entries(context.Background(), day(20), day(31)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	if fmt.Sprint(ids) != "[c00 c03 c04]" {
+		t.Errorf("got %v, want the conversations after the unreadable ones too", ids)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv, _ := fakeOmi(t, conversations(1))
+	if _, err := collect(NewClientWithURL("wrong", srv.URL, nil).Entries(context.Background(), time.Time{}, time.Time{})); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	c := NewClientWithURL("test-token", slow.URL, &http.Client{Timeout: 20 * time.Millisecond})
+	if _, err := collect(c.Entries(context.Background(), time.Time{}, time.Time{})); err == nil {
+		t.Error("expected a timeout")
+	}
+
+	if got := NewClient("t").(*Client); got.baseURL != DefaultBaseURL || got.httpClient.Timeout == 0 {
+		t.Errorf("default client: got %s with timeout %v", got.baseURL, got.httpClient.Timeout)
+	}
+}
+
+func TestEntriesStopsEarly(t *testing.T) {
+	srv, pages := fakeOmi(t, conversations(60))
+	c := NewClientWithURL("test-token", srv.URL, nil)
+
+	n := 0
+	for _, err := range c.Entries(context.Background(), time.Time{}, time.Time{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	if *pages != 1 {
+		t.Errorf("fetched %d pages after the consumer stopped on the first", *pages)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, err := collect(c.Entries(ctx, time.Time{}, time.Time{}))
+	if !errors.Is(err, context.Canceled) || len(entries) != 0 {
+		t.Errorf("got %d entries and %v, want context.Canceled", len(entries), err)
+	}
+}
@@ -1,9 +1,18 @@
 package clientiface
 
-import "github.com/sottey/ainvil/lib/model"
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/sottey/ainvil/lib/model"
+)
 
 type APIClient interface {
 	Name() string
-	GetEntries(startDate, endDate string) ([]model.Entry, error)
-	GetAllEntries() ([]model.Entry, error)
+	// Entries yields the entries that started in [start, end) as each page
+	// arrives. A zero start or end leaves that side open. An error is
+	// yielded with an empty entry and ends the iteration; cancelling ctx
+	// ends it with ctx.Err().
+	Entries(ctx context.Context, start, end time.Time) iter.Seq2[model.Entry, error]
 }
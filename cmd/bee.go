@@ -37,7 +37,10 @@ var beeCmd = &cobra.Command{
 		sourceDir, _ := cmd.Flags().GetString("source")
 		outDir, _ := cmd.Flags().GetString("out")
 
-		err := common.ProcessTextExports(sourceDir, outDir, "bee", common.ParseBeeFile)
+		opts, err := common.GetImportOptions(cmd)
+		if err == nil {
+			err = common.ProcessTextExports(cmd.Context(), sourceDir, outDir, "bee", common.ParseBeeFile, opts)
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
@@ -46,7 +49,8 @@ var beeCmd = &cobra.Command{
 }
 
 func init() {
-	common.AddCommonFileFlags(beeCmd)
+	common.AddCommonFileFlags(beeCmd, false)
 	common.AddUniversalFlags(beeCmd)
+	common.AddImportFlags(beeCmd)
 	rootCmd.AddCommand(beeCmd)
 }
@@ -0,0 +1,77 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sottey/ainvil/common"
+
+	"github.com/spf13/cobra"
+)
+
+// newCaptionCmd returns the import command for a caption format, "vtt" or
+// "srt".
+func newCaptionCmd(format, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   format,
+		Short: short,
+		Long: short + `. Each cue becomes a blockquote with its speaker and
+start/end offsets. The absolute start time of a file is taken from
+--start-time, else from a sidecar (name.` + format + `.json or name.json with a
+"startTime"), else from the file's modification time.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			sourceDir, _ := cmd.Flags().GetString("source")
+			outDir, _ := cmd.Flags().GetString("out")
+			startFlag, _ := cmd.Flags().GetString("start-time")
+
+			var start time.Time
+			opts, err := common.GetImportOptions(cmd)
+			if err == nil && startFlag != "" {
+				start, err = common.ParseCaptionStart(format, startFlag)
+				if err != nil {
+					err = fmt.Errorf("invalid --start-time: %w", err)
+				}
+			}
+			if err == nil {
+				err = common.ProcessCaptions(cmd.Context(), sourceDir, outDir, format, start, opts)
+			}
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+	common.AddCommonFileFlags(cmd, false)
+	common.AddUniversalFlags(cmd)
+	common.AddImportFlags(cmd)
+	cmd.Flags().String("start-time", "", "Start time of the recording(s), RFC3339 or \"YYYY-MM-DD HH:MM:SS\" (default: sidecar, then file modification time)")
+	cmd.Flags().Lookup("include").Usage = "Only import files matching these glob patterns (default *." + format + ")"
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newCaptionCmd("vtt", "Process WebVTT caption files"))
+	rootCmd.AddCommand(newCaptionCmd("srt", "Process SRT subtitle files"))
+}
@@ -41,7 +41,11 @@ var ChatGPTCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		if err := common.ParseChatGPTTranscripts(source, out); err != nil {
+		opts, err := common.GetImportOptions(cmd)
+		if err == nil {
+			err = common.ParseChatGPTTranscripts(cmd.Context(), source, out, opts)
+		}
+		if err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
@@ -49,7 +53,8 @@ var ChatGPTCmd = &cobra.Command{
 }
 
 func init() {
-	common.AddCommonFileFlags(ChatGPTCmd)
+	common.AddCommonFileFlags(ChatGPTCmd, false)
 	common.AddUniversalFlags(ChatGPTCmd)
+	common.AddImportFlags(ChatGPTCmd)
 	rootCmd.AddCommand(ChatGPTCmd)
 }
@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sottey/ainvil/common"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Detect and process a folder of mixed Bee, Omi and ChatGPT files",
+	Long: `Walks --source, including any .zip or .tar.gz bundles in it, and routes
+every file to the parser that recognizes it, so exports from
+different pendants can live in one folder.
+
+Built-in parsers: ` + strings.Join(common.RegisteredParsers(), ", ") + `
+
+Parser plugins (ainvil-parser-* executables in --plugin-dir or on PATH) are
+tried after the built-in parsers. List them with "ainvil plugins".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dirs, ok := common.GetPluginDirs(cmd); ok {
+			common.LoadPlugins(dirs)
+		}
+
+		sourceDir, _ := cmd.Flags().GetString("source")
+		outDir, _ := cmd.Flags().GetString("out")
+
+		opts, err := common.GetImportOptions(cmd)
+		if err == nil {
+			err = common.ImportMixedExports(cmd.Context(), sourceDir, outDir, opts)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	common.AddCommonFileFlags(importCmd, true)
+	common.AddUniversalFlags(importCmd)
+	common.AddImportFlags(importCmd)
+	common.AddPluginFlags(importCmd)
+	rootCmd.AddCommand(importCmd)
+}
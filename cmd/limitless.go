@@ -23,27 +23,47 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/sottey/ainvil/common"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var limitlessCmd = &cobra.Command{
 	Use:   "limitless",
 	Short: "Import data from Limitless API",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		apiKey := viper.GetString("token")
-		apiURL := viper.GetString("url")
-		start := viper.GetString("start")
-		outputDir := viper.GetString("out")
-
-		err := common.ParseLimitlessData(apiKey, apiURL, start, outputDir)
+		// Read from this command's flags rather than viper: other commands
+		// bind the same keys, and the last binding wins.
+		apiKey, _ := cmd.Flags().GetString("token")
+		apiURL, _ := cmd.Flags().GetString("url")
+		start, _ := cmd.Flags().GetString("start")
+		outputDir, _ := cmd.Flags().GetString("out")
 
+		opts, err := common.GetImportOptions(cmd)
 		if err != nil {
-			fmt.Println("Error handling Limitless data: ", err)
-		} else {
-			fmt.Println("Done.")
+			return err
+		}
+
+		var lopts common.LimitlessOptions
+		lopts.Lookback, _ = cmd.Flags().GetDuration("lookback")
+		lopts.Resume, _ = cmd.Flags().GetBool("resume")
+		lopts.Timeout, _ = cmd.Flags().GetDuration("timeout")
+		lopts.Retries, _ = cmd.Flags().GetInt("retries")
+		lopts.RetryDelay, _ = cmd.Flags().GetDuration("retry-delay")
+		lopts.Date, _ = cmd.Flags().GetString("date")
+		lopts.End, _ = cmd.Flags().GetString("end")
+		lopts.Direction, _ = cmd.Flags().GetString("direction")
+		lopts.StarredOnly, _ = cmd.Flags().GetBool("starred-only")
+		includeMarkdown, _ := cmd.Flags().GetBool("include-markdown")
+		includeHeadings, _ := cmd.Flags().GetBool("include-headings")
+		lopts.OmitMarkdown = !includeMarkdown
+		lopts.OmitHeadings = !includeHeadings
+
+		// From here on a failure is not a usage mistake.
+		cmd.SilenceUsage = true
+		if err := common.ParseLimitlessData(cmd.Context(), apiKey, apiURL, start, outputDir, lopts, opts); err != nil {
+			return fmt.Errorf("handling Limitless data: %w", err)
 		}
 		return nil
 	},
@@ -52,5 +72,16 @@ var limitlessCmd = &cobra.Command{
 func init() {
 	common.AddCommonAPIFlags(limitlessCmd)
 	common.AddUniversalFlags(limitlessCmd)
+	common.AddImportFlags(limitlessCmd)
+	limitlessCmd.Flags().Duration("lookback", 0, "Re-check lifelogs started this long before the last sync (e.g. 168h) and refresh edited ones, keeping the old version in history")
+	limitlessCmd.Flags().Bool("resume", false, "Continue an interrupted sync from its last completed page")
+	limitlessCmd.Flags().Duration("timeout", 30*time.Second, "Timeout for each API request")
+	limitlessCmd.Flags().Int("retries", 6, "How many times to retry a request that failed with a network error, 429 or 5xx")
+	limitlessCmd.Flags().Duration("retry-delay", time.Second, "Delay before the first retry; doubled on each further retry")
+	limitlessCmd.Flags().String("date", "", "Only fetch lifelogs that began on this day (YYYY-MM-DD, in the --tz zone)")
+	limitlessCmd.Flags().String("direction", "", "Sort order of the API results: asc or desc (API default: desc)")
+	limitlessCmd.Flags().Bool("starred-only", false, "Only fetch starred lifelogs")
+	limitlessCmd.Flags().Bool("include-markdown", true, "Ask the API for the markdown rendering of each lifelog")
+	limitlessCmd.Flags().Bool("include-headings", true, "Ask the API for heading nodes in each lifelog's contents")
 	rootCmd.AddCommand(limitlessCmd)
 }
@@ -0,0 +1,73 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sottey/ainvil/common"
+	"github.com/spf13/cobra"
+)
+
+var listenCmd = &cobra.Command{
+	Use:   "listen",
+	Short: "Receive Omi webhooks and write memories into the output tree as they arrive",
+	Long: `Starts an HTTP server that accepts Omi "memory created" and "real-time
+transcript" webhooks. Point both webhook URLs in the Omi app at
+
+  http://<host>:<port><path>?token=<secret>
+
+Real-time transcript segments are appended to an in-progress entry that is
+replaced by the finished memory once Omi sends it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out")
+		port, _ := cmd.Flags().GetInt("port")
+		path, _ := cmd.Flags().GetString("path")
+		secret, _ := cmd.Flags().GetString("secret")
+		if secret == "" {
+			secret = os.Getenv("AINVIL_WEBHOOK_SECRET")
+		}
+		if secret == "" {
+			fmt.Println("--secret (or AINVIL_WEBHOOK_SECRET) is required.")
+			os.Exit(1)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(path, common.NewOmiWebhook(outDir, secret))
+
+		fmt.Printf("Listening for Omi webhooks at http://localhost:%d%s ...\n", port, path)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	common.AddCommonServeFlags(listenCmd)
+	common.AddUniversalFlags(listenCmd)
+	listenCmd.Flags().String("path", "/webhook/omi", "URL path of the webhook endpoint")
+	listenCmd.Flags().String("secret", "", "Shared secret callers must send as ?token= or a Bearer token")
+	rootCmd.AddCommand(listenCmd)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sottey/ainvil/common"
+	"github.com/spf13/cobra"
+)
+
+var migrateSchemaCmd = &cobra.Command{
+	Use:   "migrate-schema",
+	Short: "Repair exports written by older versions from their raw data",
+	Long: `Rebuilds every Limitless export under --out from the API response kept in
+its "raw" field. Files written by older versions get the current mapping:
+the real end time instead of updatedAt, nested content nodes, location,
+tags and device type. Use --dry-run to see what would change first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out")
+
+		opts, err := common.GetImportOptions(cmd)
+		if err == nil {
+			err = common.MigrateSchema(outDir, opts)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	common.AddUniversalFlags(migrateSchemaCmd)
+	common.AddImportFlags(migrateSchemaCmd)
+	rootCmd.AddCommand(migrateSchemaCmd)
+}
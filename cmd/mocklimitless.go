@@ -0,0 +1,81 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sottey/ainvil/internal/limitlessmock"
+	"github.com/spf13/cobra"
+)
+
+var mockLimitlessCmd = &cobra.Command{
+	Use:   "mock-limitless",
+	Short: "Serve a local stand-in for the Limitless lifelogs API",
+	Long: `Serves GET /v1/lifelogs from fixture files, so the limitless command can be
+tried and demoed without a Limitless account. Each .json file in --fixtures
+may hold one lifelog, an array of lifelogs or a whole API response. Without
+--fixtures a small built-in sample is served.
+
+The server checks the API key, filters by date, start, end, timezone and
+isStarred, paginates with cursors, and can answer every Nth request with 429.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, _ := cmd.Flags().GetInt("port")
+		dir, _ := cmd.Flags().GetString("fixtures")
+		token, _ := cmd.Flags().GetString("token")
+
+		var srv *limitlessmock.Server
+		var err error
+		if dir != "" {
+			srv, err = limitlessmock.LoadDir(token, dir)
+		} else {
+			srv, err = limitlessmock.Default(token)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		srv.MaxLimit, _ = cmd.Flags().GetInt("page-size")
+		srv.RateLimitEvery, _ = cmd.Flags().GetInt("rate-limit-every")
+		srv.RetryAfter, _ = cmd.Flags().GetInt("retry-after")
+
+		url := fmt.Sprintf("http://localhost:%d%s", port, limitlessmock.LifelogsPath)
+		fmt.Printf("Serving %d lifelogs at %s ...\n", srv.Len(), url)
+		fmt.Printf("Try: ainvil limitless --token %s --url %s --out ./out\n", token, url)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), srv); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	mockLimitlessCmd.Flags().Int("port", 8787, "Port to serve on")
+	mockLimitlessCmd.Flags().String("fixtures", "", "Directory of lifelog .json files (default: built-in sample)")
+	mockLimitlessCmd.Flags().String("token", "mock-token", "API key clients must send as X-API-Key")
+	mockLimitlessCmd.Flags().Int("page-size", 10, "Maximum lifelogs per page")
+	mockLimitlessCmd.Flags().Int("rate-limit-every", 0, "Answer every Nth request with 429 Too Many Requests (0 = never)")
+	mockLimitlessCmd.Flags().Int("retry-after", 1, "Retry-After seconds sent with injected 429 responses")
+	rootCmd.AddCommand(mockLimitlessCmd)
+}
@@ -31,12 +31,34 @@ import (
 
 var omiCmd = &cobra.Command{
 	Use:   "omi",
-	Short: "Process Omi export text files",
+	Short: "Process Omi export text files, or fetch conversations from the Omi API",
+	Long: `With --source, processes Omi export text files (e.g. from the Google Drive
+plugin). With --token, fetches conversations directly from the Omi developer
+API instead.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		sourceDir, _ := cmd.Flags().GetString("source")
 		outDir, _ := cmd.Flags().GetString("out")
+		token, _ := cmd.Flags().GetString("token")
 
-		err := common.ProcessTextExports(sourceDir, outDir, "omi", common.ParseOmiFile)
+		opts, err := common.GetImportOptions(cmd)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		if token != "" && opts.Watch {
+			fmt.Println("Error: --watch works with --source, not --token")
+			os.Exit(1)
+		}
+
+		if token != "" {
+			apiURL, _ := cmd.Flags().GetString("url")
+			start, _ := cmd.Flags().GetString("start")
+			end, _ := cmd.Flags().GetString("end")
+			err = common.FetchOmiData(cmd.Context(), token, apiURL, start, end, outDir, opts)
+		} else {
+			err = common.ProcessTextExports(cmd.Context(), sourceDir, outDir, "omi", common.ParseOmiFile, opts)
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
@@ -45,7 +67,13 @@ var omiCmd = &cobra.Command{
 }
 
 func init() {
-	common.AddCommonFileFlags(omiCmd)
+	common.AddCommonFileFlags(omiCmd, false)
 	common.AddUniversalFlags(omiCmd)
+
+	omiCmd.Flags().StringP("token", "t", "", "Omi developer API key (fetch from the API instead of --source)")
+	omiCmd.Flags().StringP("url", "u", "https://api.omi.me/v1/dev", "Omi API base URL")
+	omiCmd.Flags().StringP("start", "s", "", "Only fetch conversations started on or after this date (YYYY-MM-DD or RFC3339)")
+	omiCmd.Flags().StringP("end", "e", "", "Only fetch conversations started on or before this date (YYYY-MM-DD or RFC3339)")
+	common.AddImportFlags(omiCmd)
 	rootCmd.AddCommand(omiCmd)
 }
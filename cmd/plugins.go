@@ -0,0 +1,73 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sottey/ainvil/common"
+	"github.com/spf13/cobra"
+)
+
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "List the parser plugins import would load",
+	Long: `Finds the ainvil-parser-* executables in --plugin-dir and on PATH, runs
+their handshakes and prints the formats they claim. A plugin is sent a file
+and prints a PendantExport as JSON; see the README for the protocol.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dirs, _ := common.GetPluginDirs(cmd)
+		paths := common.FindPlugins(dirs)
+		if len(paths) == 0 {
+			fmt.Printf("No plugins found in %s or on PATH\n", strings.Join(dirs, ", "))
+			return
+		}
+
+		for _, path := range paths {
+			p, err := common.OpenPlugin(path)
+			if err != nil {
+				fmt.Printf("%s\n  error: %v\n", path, err)
+				continue
+			}
+			hs := p.Handshake
+			fmt.Printf("%s (%s)\n", hs.Name, path)
+			if len(hs.Extensions) > 0 {
+				fmt.Printf("  extensions: %s\n", strings.Join(hs.Extensions, " "))
+			}
+			for _, pattern := range hs.Sniff {
+				fmt.Printf("  sniff: %s\n", pattern)
+			}
+			if hs.Stdin {
+				fmt.Println("  input: stdin")
+			}
+			if _, ok := common.LookupParser(hs.Name); ok {
+				fmt.Printf("  warning: %q is a built-in parser, the plugin will be skipped\n", hs.Name)
+			}
+		}
+	},
+}
+
+func init() {
+	pluginsCmd.Flags().StringSlice("plugin-dir", nil, "Folder to search for ainvil-parser-* plugins before PATH (default <config dir>/ainvil/parsers)")
+	rootCmd.AddCommand(pluginsCmd)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sottey/ainvil/common"
+	"github.com/spf13/cobra"
+)
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the output manifest from the export files",
+	Long: `Reads every export under --out and rewrites out/.ainvil/state.json, the
+manifest that incremental imports, stats and serve rely on. Run it after
+moving, deleting or editing export files by hand.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out")
+
+		m, err := common.Reindex(outDir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
+		counts := map[string]int{}
+		for _, e := range m.Entries {
+			counts[e.SourceType]++
+		}
+		sources := make([]string, 0, len(counts))
+		for source := range counts {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		fmt.Printf("Indexed %d exports", len(m.Entries))
+		for _, source := range sources {
+			fmt.Printf(", %d %s", counts[source], source)
+		}
+		fmt.Println()
+	},
+}
+
+func init() {
+	common.AddUniversalFlags(reindexCmd)
+	rootCmd.AddCommand(reindexCmd)
+}
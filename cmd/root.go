@@ -22,23 +22,42 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/sottey/ainvil/common"
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "ainvil",
 	Short: "A tool for normalizing and organizing all your pendant data",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		tz, _ := cmd.Flags().GetString("tz")
+		overrides, _ := cmd.Flags().GetStringSlice("source-tz")
+		return common.ConfigureTimezones(tz, overrides)
+	},
 }
 
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl-C cancels the command's context; importers finish the files they
+	// are working on and stop. A second Ctrl-C kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
 func init() {
-
+	rootCmd.PersistentFlags().String("tz", "", "Default IANA timezone for source timestamps (default: system timezone)")
+	rootCmd.PersistentFlags().StringSlice("source-tz", nil, "Per-source timezone override, e.g. --source-tz bee=America/Los_Angeles")
 }
@@ -6,9 +6,9 @@ import (
 	"html/template"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
-	"strings"
 
 	"github.com/sottey/ainvil/common"
 	"github.com/spf13/cobra"
@@ -29,29 +29,37 @@ var serveCmd = &cobra.Command{
 		outDir, _ := cmd.Flags().GetString("out")
 		port, _ := cmd.Flags().GetInt("port")
 
+		manifest, err := common.OpenManifest(outDir)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+
 		files := []ExportFile{}
-		_ = filepath.Walk(outDir, func(path string, info os.FileInfo, err error) error {
-			if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
-				relPath, _ := filepath.Rel(outDir, path)
-				parts := strings.Split(relPath, string(os.PathSeparator))
-				if len(parts) >= 4 {
-					date := fmt.Sprintf("%s-%s-%s", parts[0], parts[1], parts[2])
-					name := parts[3]
-					pendant := strings.SplitN(name, "_", 2)[0]
-					files = append(files, ExportFile{
-						Pendant:  pendant,
-						Date:     date,
-						FileName: name,
-						FullPath: path,
-						WebPath:  "/view?file=" + relPath,
-					})
-				}
+		for relPath, entry := range manifest.Entries {
+			date := "undated"
+			if t, ok := common.EntryDate(relPath); ok {
+				date = t.Format("2006-01-02")
 			}
-			return nil
-		})
+			files = append(files, ExportFile{
+				Pendant:  entry.SourceType,
+				Date:     date,
+				FileName: path.Base(relPath),
+				FullPath: filepath.Join(outDir, filepath.FromSlash(relPath)),
+				WebPath:  "/view?file=" + relPath,
+			})
+		}
 
+		// Newest first, undated entries last.
 		sort.Slice(files, func(i, j int) bool {
-			return files[i].Date > files[j].Date
+			a, b := files[i], files[j]
+			if (a.Date == "undated") != (b.Date == "undated") {
+				return b.Date == "undated"
+			}
+			if a.Date != b.Date {
+				return a.Date > b.Date
+			}
+			return a.FileName < b.FileName
 		})
 
 		tmpl := template.Must(template.New("index").Parse(`
@@ -2,12 +2,10 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
-	"time"
 
+	"github.com/sottey/ainvil/common"
 	"github.com/spf13/cobra"
 )
 
@@ -17,57 +15,15 @@ var statsCmd = &cobra.Command{
 	Use:   "stats",
 	Short: "Show total lifelog count and most recent capture date for each pendant",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		type stat struct {
-			count      int
-			latestDate time.Time
-		}
-
-		stats := make(map[string]*stat)
-
-		err := filepath.Walk(statsOutDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil || info.IsDir() {
-				return nil
-			}
-			if !strings.HasSuffix(info.Name(), ".json") {
-				return nil
-			}
-
-			// Extract pendant and date from path
-			parts := strings.Split(path, string(filepath.Separator))
-			if len(parts) < 4 {
-				return nil
-			}
-
-			year := parts[len(parts)-4]
-			month := parts[len(parts)-3]
-			day := parts[len(parts)-2]
-
-			dateStr := fmt.Sprintf("%s-%s-%s", year, month, day)
-			date, err := time.Parse("2006-01-02", dateStr)
-			if err != nil {
-				return nil
-			}
-
-			fileName := info.Name()
-			pendant := strings.SplitN(fileName, "_", 2)[0]
-
-			if _, ok := stats[pendant]; !ok {
-				stats[pendant] = &stat{}
-			}
-			stats[pendant].count++
-			if date.After(stats[pendant].latestDate) {
-				stats[pendant].latestDate = date
-			}
-			return nil
-		})
-
+		manifest, err := common.OpenManifest(statsOutDir)
 		if err != nil {
 			return err
 		}
+		stats := manifest.Stats()
 
 		// Pretty output
-		fmt.Printf("%-10s | %-5s | %-15s\n", "Pendant", "Count", "Last Capture")
-		fmt.Println(strings.Repeat("-", 36))
+		fmt.Printf("%-10s | %-5s | %-7s | %-15s\n", "Pendant", "Count", "Undated", "Last Capture")
+		fmt.Println(strings.Repeat("-", 46))
 
 		pendants := make([]string, 0, len(stats))
 		for p := range stats {
@@ -77,7 +33,11 @@ var statsCmd = &cobra.Command{
 
 		for _, p := range pendants {
 			s := stats[p]
-			fmt.Printf("%-10s | %-5d | %s\n", p, s.count, s.latestDate.Format("2006-01-02"))
+			latest := "-"
+			if !s.Latest.IsZero() {
+				latest = s.Latest.Format("2006-01-02")
+			}
+			fmt.Printf("%-10s | %-5d | %-7d | %s\n", p, s.Count, s.Undated, latest)
 		}
 
 		return nil
@@ -0,0 +1,281 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimitlessTimeout    = 30 * time.Second
+	defaultLimitlessRetries    = 6
+	defaultLimitlessRetryDelay = time.Second
+	limitlessMaxRetryDelay     = 2 * time.Minute
+)
+
+// errUnauthorized is returned for 401 and 403 responses, which no amount of
+// retrying will fix.
+var errUnauthorized = errors.New("unauthorized: check API token")
+
+// LimitlessClient talks to the Limitless lifelogs API. Failed requests are
+// retried with exponential backoff and jitter: network errors and timeouts,
+// 429 and 5xx responses. A Retry-After header on the response takes
+// precedence over the computed delay.
+type LimitlessClient struct {
+	Token   string
+	BaseURL string
+	HTTP    *http.Client
+	// Retries is how many times a failed request is retried.
+	Retries int
+	// RetryDelay is the delay before the first retry. It doubles on each
+	// further attempt, up to two minutes.
+	RetryDelay time.Duration
+	// OnPage, if set, is called by Lifelogs once every lifelog of a page has
+	// been yielded, with how many there were and the cursor of the next
+	// page, which is empty after the last one. An error from it ends the
+	// iteration.
+	OnPage func(count int, next string) error
+
+	// sleep waits between attempts. Tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewLimitlessClient returns a client for the lifelogs endpoint at baseURL.
+// A timeout of 0 means the default of 30 seconds per request.
+func NewLimitlessClient(token, baseURL string, timeout time.Duration) *LimitlessClient {
+	if timeout <= 0 {
+		timeout = defaultLimitlessTimeout
+	}
+	return &LimitlessClient{
+		Token:      token,
+		BaseURL:    baseURL,
+		HTTP:       &http.Client{Timeout: timeout},
+		Retries:    defaultLimitlessRetries,
+		RetryDelay: defaultLimitlessRetryDelay,
+		sleep:      sleepCtx,
+	}
+}
+
+// LimitlessPage is one page of the lifelogs listing.
+type LimitlessPage struct {
+	Lifelogs   []json.RawMessage
+	NextCursor string
+}
+
+type limitlessResponse struct {
+	Data struct {
+		Lifelogs []json.RawMessage `json:"lifelogs"`
+	} `json:"data"`
+	Meta struct {
+		Lifelogs struct {
+			NextCursor string `json:"nextCursor"`
+		} `json:"lifelogs"`
+	} `json:"meta"`
+}
+
+// Page fetches one page of lifelogs matching params.
+func (c *LimitlessClient) Page(ctx context.Context, params url.Values) (*LimitlessPage, error) {
+	reqURL := c.BaseURL + "?" + params.Encode()
+
+	body, err := c.get(ctx, reqURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp limitlessResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decoding lifelogs: %w", err)
+	}
+	return &LimitlessPage{
+		Lifelogs:   resp.Data.Lifelogs,
+		NextCursor: resp.Meta.Lifelogs.NextCursor,
+	}, nil
+}
+
+// Lifelogs follows the cursors from params onwards and yields every lifelog
+// as its page arrives, so only one page is held in memory. It stops at the
+// first error, which is yielded with a nil lifelog, when the consumer stops
+// or when ctx is cancelled.
+func (c *LimitlessClient) Lifelogs(ctx context.Context, params url.Values) iter.Seq2[json.RawMessage, error] {
+	return func(yield func(json.RawMessage, error) bool) {
+		query := url.Values{}
+		for k, v := range params {
+			query[k] = v
+		}
+		for {
+			page, err := c.Page(ctx, query)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, raw := range page.Lifelogs {
+				if !yield(raw, nil) {
+					return
+				}
+			}
+			next := page.NextCursor
+			if len(page.Lifelogs) == 0 {
+				next = ""
+			}
+			if c.OnPage != nil {
+				if err := c.OnPage(len(page.Lifelogs), next); err != nil {
+					yield(nil, err)
+					return
+				}
+			}
+			if next == "" {
+				return
+			}
+			query.Set("cursor", next)
+		}
+	}
+}
+
+// retryableError marks a failure worth another attempt. wait, if set, is
+// the delay asked for by the server.
+type retryableError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// get performs a GET, retrying as described on LimitlessClient.
+func (c *LimitlessClient) get(ctx context.Context, reqURL string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := c.try(ctx, reqURL)
+		var retry *retryableError
+		if err == nil || !errors.As(err, &retry) {
+			return body, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= c.Retries {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+
+		wait := retry.wait
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		fmt.Printf("%v. Retrying in %s...\n", err, wait.Round(time.Millisecond))
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// try performs a single attempt.
+func (c *LimitlessClient) try(ctx context.Context, reqURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", c.Token)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &retryableError{err: fmt.Errorf("request error: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("reading response: %w", err)}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return body, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, errUnauthorized
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, &retryableError{
+			err:  fmt.Errorf("limitless API returned %s", resp.Status),
+			wait: retryAfter(resp.Header.Get("Retry-After")),
+		}
+	default:
+		return nil, fmt.Errorf("limitless API returned %s: %s", resp.Status, truncate(string(body), 200))
+	}
+}
+
+// backoff is the delay before retry number attempt+1: RetryDelay doubled
+// attempt times, capped, with the upper half randomized so that clients
+// that failed together do not retry together.
+func (c *LimitlessClient) backoff(attempt int) time.Duration {
+	d := c.RetryDelay << attempt
+	if d <= 0 || d > limitlessMaxRetryDelay {
+		d = limitlessMaxRetryDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date, capped at limitlessMaxRetryDelay. It returns 0 if the header is
+// missing or invalid.
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return min(time.Duration(secs)*time.Second, limitlessMaxRetryDelay)
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return min(d, limitlessMaxRetryDelay)
+		}
+	}
+	return 0
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,352 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedServer answers request n with responses[n], and with 200 and an
+// empty page once the script runs out.
+func scriptedServer(t *testing.T, responses ...func(w http.ResponseWriter)) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		if n < len(responses) {
+			responses[n](w)
+			return
+		}
+		w.Write([]byte(`{"data":{"lifelogs":[]},"meta":{"lifelogs":{}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func status(code int, header ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(code)
+	}
+}
+
+// testClient returns a client for srv that records its waits instead of
+// sleeping.
+func testClient(srv *httptest.Server, waits *[]time.Duration) *LimitlessClient {
+	c := NewLimitlessClient("key", srv.URL, time.Second)
+	c.RetryDelay = 100 * time.Millisecond
+	c.sleep = func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return c
+}
+
+func TestLimitlessClientRetriesAndHonorsRetryAfter(t *testing.T) {
+	silenceStdout(t)
+	srv, calls := scriptedServer(t,
+		status(http.StatusTooManyRequests, "Retry-After", "7"),
+		status(http.StatusInternalServerError),
+		status(http.StatusBadGateway),
+	)
+
+	var waits []time.Duration
+	page, err := testClient(srv, &waits).Page(context.Background(), url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Lifelogs) != 0 || *calls != 4 {
+		t.Fatalf("got %d lifelogs after %d calls, want 0 after 4", len(page.Lifelogs), *calls)
+	}
+	if len(waits) != 3 || waits[0] != 7*time.Second {
+		t.Fatalf("waits = %v, want Retry-After of 7s first", waits)
+	}
+	// Second and third retries back off exponentially with jitter in the
+	// upper half.
+	for i, want := range []time.Duration{200 * time.Millisecond, 400 * time.Millisecond} {
+		if w := waits[i+1]; w < want/2 || w > want {
+			t.Errorf("wait %d = %s, want between %s and %s", i+1, w, want/2, want)
+		}
+	}
+}
+
+func TestLimitlessClientRetriesTimeouts(t *testing.T) {
+	silenceStdout(t)
+	block := make(chan struct{})
+	defer close(block)
+	srv, calls := scriptedServer(t, func(w http.ResponseWriter) { <-block })
+
+	var waits []time.Duration
+	c := testClient(srv, &waits)
+	c.HTTP.Timeout = 50 * time.Millisecond
+	if _, err := c.Page(context.Background(), url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 || len(waits) != 1 {
+		t.Fatalf("calls = %d, waits = %v; want one timed out attempt and one retry", *calls, waits)
+	}
+}
+
+func TestLimitlessClientGivesUp(t *testing.T) {
+	silenceStdout(t)
+	srv, calls := scriptedServer(t,
+		status(http.StatusServiceUnavailable),
+		status(http.StatusServiceUnavailable),
+		status(http.StatusServiceUnavailable),
+		status(http.StatusServiceUnavailable),
+	)
+
+	var waits []time.Duration
+	c := testClient(srv, &waits)
+	c.Retries = 2
+	if _, err := c.Page(context.Background(), url.Values{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if *calls != 3 {
+		t.Fatalf("calls = %d, want 3", *calls)
+	}
+}
+
+func TestLimitlessClientDoesNotRetryClientErrors(t *testing.T) {
+	for _, code := range []int{http.StatusUnauthorized, http.StatusBadRequest} {
+		srv, calls := scriptedServer(t, status(code))
+		var waits []time.Duration
+		if _, err := testClient(srv, &waits).Page(context.Background(), url.Values{}); err == nil {
+			t.Fatalf("%d: expected an error", code)
+		}
+		if *calls != 1 {
+			t.Fatalf("%d: calls = %d, want 1", code, *calls)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d := retryAfter("12"); d != 12*time.Second {
+		t.Errorf("seconds: got %s", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := retryAfter(date); d < 55*time.Second || d > time.Minute {
+		t.Errorf("date: got %s", d)
+	}
+	if d := retryAfter("86400"); d != limitlessMaxRetryDelay {
+		t.Errorf("a day in seconds: got %s, want the %s cap", d, limitlessMaxRetryDelay)
+	}
+	date = time.Now().Add(24 * time.Hour).UTC().Format(http.TimeFormat)
+	if d := retryAfter(date); d != limitlessMaxRetryDelay {
+		t.Errorf("a day away: got %s, want the %s cap", d, limitlessMaxRetryDelay)
+	}
+	for _, h := range []string{"", "soon", "-3"} {
+		if d := retryAfter(h); d != 0 {
+			t.Errorf("%q: got %s, want 0", h, d)
+		}
+	}
+}
+
+// pagedLifelogServer serves pages lifelogs per page, three pages in all. It
+// fails every request for the second page while failing is set.
+type pagedLifelogServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failing  bool
+	requests []url.Values
+}
+
+func newPagedLifelogServer(t *testing.T) *pagedLifelogServer {
+	s := &pagedLifelogServer{failing: true}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.URL.Query())
+
+		if r.Header.Get("X-API-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page := 1
+		switch r.URL.Query().Get("cursor") {
+		case "p2":
+			page = 2
+		case "p3":
+			page = 3
+		}
+		if page == 2 && s.failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		next := ""
+		if page < 3 {
+			next = fmt.Sprintf("p%d", page+1)
+		}
+		var lifelogs []string
+		for i := 0; i < 2; i++ {
+			lifelogs = append(lifelogs, fmt.Sprintf(`{"id":"log-%d-%d","title":"Log","startTime":"2025-06-0%dT10:00:00Z","endTime":"2025-06-0%dT10:30:00Z","updatedAt":"2025-06-0%dT11:00:00Z"}`, page, i, page, page, page))
+		}
+		fmt.Fprintf(w, `{"data":{"lifelogs":[%s,%s]},"meta":{"lifelogs":{"nextCursor":%q}}}`, lifelogs[0], lifelogs[1], next)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestParseLimitlessDataResume(t *testing.T) {
+	silenceStdout(t)
+	srv := newPagedLifelogServer(t)
+	out := t.TempDir()
+	lopts := LimitlessOptions{Retries: 1, RetryDelay: time.Millisecond}
+
+	err := ParseLimitlessData(context.Background(), "key", srv.URL, "2025-06-01", out, lopts, ImportOptions{})
+	if err == nil {
+		t.Fatal("expected the sync to fail on page 2")
+	}
+
+	m, err := loadManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 2 {
+		t.Fatalf("page 1 should be saved, got %d entries", len(m.Entries))
+	}
+	cp := m.Sources["limitless"].Checkpoint
+	if cp == nil || cp.Cursor != "p2" || cp.Page != 2 {
+		t.Fatalf("checkpoint = %+v, want cursor p2 on page 2", cp)
+	}
+
+	srv.mu.Lock()
+	srv.failing = false
+	srv.requests = nil
+	srv.mu.Unlock()
+
+	lopts.Resume = true
+	if err := ParseLimitlessData(context.Background(), "key", srv.URL, "", out, lopts, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := srv.requests[0].Get("cursor"); got != "p2" {
+		t.Fatalf("resumed sync started with cursor %q, want p2", got)
+	}
+	if got := srv.requests[0].Get("start"); got != "2025-06-01" {
+		t.Fatalf("cursor request has start %q, want the original range kept", got)
+	}
+	if m, err = loadManifest(out); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 6 {
+		t.Fatalf("got %d entries after resuming, want 6", len(m.Entries))
+	}
+	if cp := m.Sources["limitless"].Checkpoint; cp != nil {
+		t.Fatalf("checkpoint not cleared: %+v", cp)
+	}
+}
+
+func TestLimitlessClientLifelogs(t *testing.T) {
+	srv := newPagedLifelogServer(t)
+	srv.failing = false
+	c := NewLimitlessClient("key", srv.URL, time.Second)
+
+	var pages []string
+	c.OnPage = func(count int, next string) error {
+		pages = append(pages, fmt.Sprintf("%d:%s", count, next))
+		return nil
+	}
+	var ids []string
+	for raw, err := range c.Lifelogs(context.Background(), url.Values{"start": {"2025-06-01"}}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		var item LimitlessLifelog
+		if err := json.Unmarshal(raw, &item); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.ID)
+	}
+	if got := strings.Join(ids, " "); got != "log-1-0 log-1-1 log-2-0 log-2-1 log-3-0 log-3-1" {
+		t.Errorf("got %s", got)
+	}
+	if got := strings.Join(pages, " "); got != "2:p2 2:p3 2:" {
+		t.Errorf("OnPage calls: %s", got)
+	}
+	for i, q := range srv.requests {
+		if q.Get("start") != "2025-06-01" || q.Get("cursor") != []string{"", "p2", "p3"}[i] {
+			t.Errorf("request %d: %v", i, q)
+		}
+	}
+
+	t.Run("consumer stops", func(t *testing.T) {
+		srv.requests, pages = nil, nil
+		for range c.Lifelogs(context.Background(), nil) {
+			break
+		}
+		if len(srv.requests) != 1 || len(pages) != 0 {
+			t.Errorf("got %d requests and OnPage calls %v after the first lifelog", len(srv.requests), pages)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		srv.requests = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		n := 0
+		var last error
+		for _, err := range c.Lifelogs(ctx, nil) {
+			if err != nil {
+				last = err
+				continue
+			}
+			if n++; n == 2 {
+				cancel()
+			}
+		}
+		if !errors.Is(last, context.Canceled) || n != 2 || len(srv.requests) != 1 {
+			t.Errorf("got %d lifelogs, %d requests and %v", n, len(srv.requests), last)
+		}
+	})
+
+	t.Run("OnPage error", func(t *testing.T) {
+		srv.requests = nil
+		c.OnPage = func(int, string) error { return errors.New("disk full") }
+		n := 0
+		var last error
+		for _, err := range c.Lifelogs(context.Background(), nil) {
+			if err != nil {
+				last = err
+				continue
+			}
+			n++
+		}
+		if last == nil || last.Error() != "disk full" || n != 2 || len(srv.requests) != 1 {
+			t.Errorf("got %d lifelogs, %d requests and %v", n, len(srv.requests), last)
+		}
+	})
+}
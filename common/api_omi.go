@@ -0,0 +1,349 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOmiURL = "https://api.omi.me/v1/dev"
+	omiPageSize   = 25
+)
+
+// OmiConversation is a conversation (formerly "memory") as returned by the
+// Omi developer API.
+type OmiConversation struct {
+	ID                 string              `json:"id"`
+	CreatedAt          string              `json:"created_at"`
+	StartedAt          string              `json:"started_at"`
+	FinishedAt         string              `json:"finished_at"`
+	Source             string              `json:"source"`
+	Language           string              `json:"language"`
+	Structured         OmiStructured       `json:"structured"`
+	TranscriptSegments []OmiTranscriptLine `json:"transcript_segments"`
+	Geolocation        *OmiGeolocation     `json:"geolocation"`
+	Discarded          bool                `json:"discarded"`
+	Raw                json.RawMessage     `json:"-"`
+}
+
+type OmiStructured struct {
+	Title       string          `json:"title"`
+	Overview    string          `json:"overview"`
+	Emoji       string          `json:"emoji"`
+	Category    string          `json:"category"`
+	ActionItems []OmiActionItem `json:"action_items"`
+}
+
+type OmiActionItem struct {
+	Description string `json:"description"`
+	Completed   bool   `json:"completed"`
+}
+
+type OmiTranscriptLine struct {
+	Text      string  `json:"text"`
+	Speaker   string  `json:"speaker"`
+	SpeakerID int     `json:"speaker_id"`
+	IsUser    bool    `json:"is_user"`
+	PersonID  string  `json:"person_id"`
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+}
+
+type OmiGeolocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Address   string  `json:"address"`
+}
+
+// OmiClient talks to the Omi developer API.
+type OmiClient struct {
+	Token   string
+	BaseURL string
+	HTTP    *http.Client
+}
+
+func NewOmiClient(token, baseURL string) *OmiClient {
+	if baseURL == "" {
+		baseURL = defaultOmiURL
+	}
+	return &OmiClient{
+		Token:   token,
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    http.DefaultClient,
+	}
+}
+
+// Conversations returns the conversations that started inside [start, end].
+// A zero start or end leaves that side of the range open.
+func (c *OmiClient) Conversations(start, end time.Time) ([]OmiConversation, error) {
+	var all []OmiConversation
+	for conv, err := range c.Stream(context.Background(), start, end) {
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, conv)
+	}
+	return all, nil
+}
+
+// Stream pages through the user's conversations, newest first, and yields
+// those that started inside [start, end] one page at a time. A zero start or
+// end leaves that side of the range open. Paging stops at the first
+// conversation older than start, at the first error, or when ctx is
+// cancelled.
+func (c *OmiClient) Stream(ctx context.Context, start, end time.Time) iter.Seq2[OmiConversation, error] {
+	return func(yield func(OmiConversation, error) bool) {
+		for offset := 0; ; offset += omiPageSize {
+			page, err := c.fetchPage(ctx, offset)
+			if err != nil {
+				yield(OmiConversation{}, err)
+				return
+			}
+
+			done := len(page) < omiPageSize
+			for _, conv := range page {
+				if conv.Discarded {
+					continue
+				}
+				if t, err := time.Parse(time.RFC3339, conv.startedAt()); err == nil {
+					if !end.IsZero() && t.After(end) {
+						continue
+					}
+					if !start.IsZero() && t.Before(start) {
+						done = true
+						break
+					}
+				}
+				if !yield(conv, nil) {
+					return
+				}
+			}
+
+			if done {
+				return
+			}
+		}
+	}
+}
+
+func (c *OmiClient) fetchPage(ctx context.Context, offset int) ([]OmiConversation, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(omiPageSize))
+	q.Set("offset", strconv.Itoa(offset))
+	q.Set("include_transcript", "true")
+	reqURL := c.BaseURL + "/user/conversations?" + q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, errors.New("unauthorized: check API token")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("omi API error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(body, &raws); err != nil {
+		return nil, fmt.Errorf("decoding conversations: %w", err)
+	}
+
+	convs := make([]OmiConversation, 0, len(raws))
+	for _, raw := range raws {
+		var conv OmiConversation
+		if err := json.Unmarshal(raw, &conv); err != nil {
+			fmt.Println("Skipping malformed conversation:", err)
+			continue
+		}
+		conv.Raw = raw
+		convs = append(convs, conv)
+	}
+	return convs, nil
+}
+
+func (c OmiConversation) startedAt() string {
+	if c.StartedAt != "" {
+		return c.StartedAt
+	}
+	return c.CreatedAt
+}
+
+// ToPendantExport maps a conversation onto the shared export format, with one
+// blockquote per transcript segment in the shape Limitless produces.
+func (c OmiConversation) ToPendantExport() *PendantExport {
+	start, startErr := ParseSourceTime("omi", c.startedAt())
+
+	contents := []ContentEntry{
+		{Type: "heading1", Content: c.Structured.Title},
+		{Type: "heading2", Content: c.Structured.Overview},
+	}
+
+	var transcript []string
+	for _, seg := range c.TranscriptSegments {
+		entry := ContentEntry{
+			Type:          "blockquote",
+			Content:       strings.TrimSpace(seg.Text),
+			SpeakerName:   seg.speakerName(),
+			StartOffsetMs: int(seg.Start * 1000),
+			EndOffsetMs:   int(seg.End * 1000),
+		}
+		if seg.IsUser {
+			entry.SpeakerIdentifier = "user"
+		}
+		if startErr == nil {
+			entry.StartTime = start.Add(time.Duration(seg.Start * float64(time.Second))).Format(time.RFC3339)
+			entry.EndTime = start.Add(time.Duration(seg.End * float64(time.Second))).Format(time.RFC3339)
+		}
+		contents = append(contents, entry)
+		transcript = append(transcript, fmt.Sprintf("%s: %s", entry.SpeakerName, entry.Content))
+	}
+
+	if len(c.Structured.ActionItems) > 0 {
+		contents = append(contents, ContentEntry{Type: "heading2", Content: "Action Items"})
+		for _, item := range c.Structured.ActionItems {
+			box := "[ ]"
+			if item.Completed {
+				box = "[x]"
+			}
+			contents = append(contents, ContentEntry{Type: "paragraph", Content: box + " " + item.Description})
+		}
+	}
+
+	export := &PendantExport{
+		ID:         c.ID,
+		SourceType: "omi",
+		StartTime:  normalizeOrRaw("omi", c.startedAt()),
+		EndTime:    normalizeOrRaw("omi", c.FinishedAt),
+		Title:      c.Structured.Title,
+		Overview:   c.Structured.Overview,
+		Transcript: strings.Join(transcript, "\n"),
+		Contents:   contents,
+		CreatedAt:  c.CreatedAt,
+		DeviceType: c.Source,
+		Raw:        c.Raw,
+	}
+	if c.Geolocation != nil {
+		export.Latitude = strconv.FormatFloat(c.Geolocation.Latitude, 'f', -1, 64)
+		export.Longitude = strconv.FormatFloat(c.Geolocation.Longitude, 'f', -1, 64)
+		export.Address = c.Geolocation.Address
+	}
+	return export
+}
+
+func (s OmiTranscriptLine) speakerName() string {
+	if s.IsUser {
+		return "You"
+	}
+	if s.Speaker != "" {
+		return s.Speaker
+	}
+	return fmt.Sprintf("SPEAKER_%02d", s.SpeakerID)
+}
+
+// FetchOmiData downloads conversations from the Omi API and saves them under
+// outputDir as they arrive. start and end are optional YYYY-MM-DD or RFC3339
+// dates.
+func FetchOmiData(ctx context.Context, apiKey, apiURL, start, end, outputDir string, opts ImportOptions) error {
+	if apiKey == "" {
+		return errors.New("missing --token")
+	}
+
+	startT, err := parseOmiDateFlag(start, false)
+	if err != nil {
+		return fmt.Errorf("invalid --start: %w", err)
+	}
+	endT, err := parseOmiDateFlag(end, true)
+	if err != nil {
+		return fmt.Errorf("invalid --end: %w", err)
+	}
+
+	w, err := NewExportWriter(outputDir, opts)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	found := 0
+	for conv, err := range NewOmiClient(apiKey, apiURL).Stream(ctx, startT, endT) {
+		if err != nil {
+			return err
+		}
+		found++
+		export := conv.ToPendantExport()
+		export.ExportDate = time.Now().UTC().Format(time.RFC3339)
+		export.ExportVersion = GetVersion()
+		export.SourceFile = "omiAPI"
+
+		entry, err := w.Save("omiAPI:"+export.ID, export)
+		if err != nil {
+			fmt.Printf("Error saving %s: %v\n", export.ID, err)
+		} else if !opts.DryRun {
+			printSaved(export.ID, entry)
+		}
+	}
+	fmt.Printf("Found %d conversations\n", found)
+
+	return w.Finish()
+}
+
+// parseOmiDateFlag accepts RFC3339 or YYYY-MM-DD. A bare end date covers the
+// whole day.
+func parseOmiDateFlag(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newOmiTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	fixture, err := os.ReadFile(filepath.Join("testdata", "omi", "conversations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/user/conversations" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("offset") != "0" {
+			w.Write([]byte("[]"))
+			return
+		}
+		w.Write(fixture)
+	}))
+}
+
+func TestOmiClientConversations(t *testing.T) {
+	srv := newOmiTestServer(t)
+	defer srv.Close()
+
+	convs, err := NewOmiClient("test-token", srv.URL).Conversations(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 2 {
+		t.Fatalf("got %d conversations, want 2 (discarded one skipped)", len(convs))
+	}
+
+	start, _ := time.Parse(time.RFC3339, "2025-06-03T00:00:00Z")
+	convs, err = NewOmiClient("test-token", srv.URL).Conversations(start, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 1 || convs[0].ID != "conv-3" {
+		t.Fatalf("start filter: got %+v", convs)
+	}
+
+	if _, err := NewOmiClient("wrong", srv.URL).Conversations(time.Time{}, time.Time{}); err == nil {
+		t.Fatal("expected unauthorized error")
+	}
+}
+
+func TestOmiClientStreamCancel(t *testing.T) {
+	srv := newOmiTestServer(t)
+	defer srv.Close()
+	client := NewOmiClient("test-token", srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range client.Stream(ctx, time.Time{}, time.Time{}) {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	}
+
+	n := 0
+	for _, err := range client.Stream(context.Background(), time.Time{}, time.Time{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("stopping early yielded %d conversations", n)
+	}
+}
+
+func TestOmiConversationToPendantExport(t *testing.T) {
+	srv := newOmiTestServer(t)
+	defer srv.Close()
+
+	if err := ConfigureTimezones("", []string{"omi=UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(sourceLocations, "omi")
+
+	convs, err := NewOmiClient("test-token", srv.URL).Conversations(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := convs[0].ToPendantExport()
+
+	if export.ID != "conv-3" || export.Title != "Roadmap Review" || export.EndTime != "2025-06-05T16:30:00Z" {
+		t.Errorf("unexpected header fields: %+v", export)
+	}
+	if export.Latitude != "47.6062" || export.Address != "Seattle, WA" {
+		t.Errorf("unexpected location: %q %q", export.Latitude, export.Address)
+	}
+	if len(export.Raw) == 0 {
+		t.Error("raw conversation not preserved")
+	}
+
+	var quotes []ContentEntry
+	var items []string
+	for _, c := range export.Contents {
+		switch c.Type {
+		case "blockquote":
+			quotes = append(quotes, c)
+		case "paragraph":
+			items = append(items, c.Content)
+		}
+	}
+	if len(quotes) != 2 {
+		t.Fatalf("got %d blockquotes, want 2", len(quotes))
+	}
+	if quotes[0].SpeakerIdentifier != "user" || quotes[0].SpeakerName != "You" {
+		t.Errorf("user segment not tagged: %+v", quotes[0])
+	}
+	if quotes[1].StartOffsetMs != 2500 || quotes[1].EndOffsetMs != 5250 || quotes[1].StartTime != "2025-06-05T16:00:02Z" {
+		t.Errorf("unexpected timing: %+v", quotes[1])
+	}
+	if len(items) != 2 || items[0] != "[ ] Send roadmap deck to the team" || items[1] != "[x] Book follow-up" {
+		t.Errorf("unexpected action items: %v", items)
+	}
+}
+
+func TestFetchOmiData(t *testing.T) {
+	srv := newOmiTestServer(t)
+	defer srv.Close()
+
+	out := t.TempDir()
+	if err := FetchOmiData(context.Background(), "test-token", srv.URL, "2025-06-01", "2025-06-01", out, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "2025", "06", "01", "omi_conv-1.json")); err != nil {
+		t.Fatalf("expected saved export: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "2025", "06", "05", "omi_conv-3.json")); err == nil {
+		t.Fatal("conversation outside --end was saved")
+	}
+}
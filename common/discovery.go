@@ -0,0 +1,309 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveSep separates an archive's path from the path of a file inside it
+// in SourceFile, as in "/exports/bee.zip!/2025/06/bee_1.txt".
+const archiveSep = "!/"
+
+// sourceFile is one input of an import run. Path is where it can be read and
+// Name is what is recorded in SourceFile and the plan. For a plain file both
+// are its absolute path; for a file inside an archive Path is a temporary
+// copy and Name is the archive path plus the in-archive path. Err is set,
+// and Path and Name are the archive's, for an archive that could not be
+// read; it is rejected instead of parsed.
+type sourceFile struct {
+	Path string
+	Name string
+	Err  error
+}
+
+// label is the short name used in progress output.
+func (s sourceFile) label() string {
+	if archive, member, ok := strings.Cut(s.Name, archiveSep); ok {
+		return filepath.Base(archive) + archiveSep + member
+	}
+	return filepath.Base(s.Name)
+}
+
+// localSources wraps plain file paths as sourceFiles.
+func localSources(paths []string) []sourceFile {
+	files := make([]sourceFile, len(paths))
+	for i, p := range paths {
+		abs, _ := filepath.Abs(p)
+		files[i] = sourceFile{Path: p, Name: abs}
+	}
+	return files
+}
+
+// isArchive reports whether name is a bundle collectSources reads into.
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlobs reports whether rel, a slash separated path relative to the
+// source directory or archive root, matches any of patterns. Patterns
+// without a slash are matched against the base name only, so "*.txt" picks
+// up text files at any depth.
+func matchGlobs(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		target := rel
+		if !strings.Contains(p, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGlobs returns an error for the first malformed pattern.
+func ValidateGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// selected reports whether a file at rel passes the include and exclude
+// filters. defaultInclude applies when no --include was given.
+func selected(opts ImportOptions, defaultInclude []string, rel string) bool {
+	include := opts.Include
+	if len(include) == 0 {
+		include = defaultInclude
+	}
+	if len(include) > 0 && !matchGlobs(include, rel) {
+		return false
+	}
+	return !matchGlobs(opts.Exclude, rel)
+}
+
+// hiddenPath reports whether any element of a slash separated path starts
+// with a dot, or is the __MACOSX folder macOS adds to zip files.
+func hiddenPath(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// collectSources lists the files below sourceDir selected by opts, opening
+// any .zip, .tar.gz, .tgz or .tar bundle it meets and selecting from its
+// contents the same way. Archives are always read in full; opts.Recursive
+// only governs folders on disk. Files inside archives are copied to a
+// temporary folder which the returned cleanup func removes; it must be
+// called once the files have been processed. If keep is not nil, files on
+// disk for which it returns false are left out before any archive is opened.
+// An archive that is corrupt or cut short is listed as a whole with Err set,
+// so that it is rejected while the other files are still imported.
+func collectSources(sourceDir string, opts ImportOptions, defaultInclude []string, keep func(path string, info fs.FileInfo) bool) ([]sourceFile, func(), error) {
+	var (
+		files   []sourceFile
+		copies  int
+		tmpDir  string
+		cleanup = func() {
+			if tmpDir != "" {
+				os.RemoveAll(tmpDir)
+			}
+		}
+	)
+
+	err := filepath.WalkDir(sourceDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == sourceDir {
+			return nil
+		}
+		rel, _ := filepath.Rel(sourceDir, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if !opts.Recursive || hiddenPath(d.Name()) || matchGlobs(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hiddenPath(d.Name()) || !d.Type().IsRegular() {
+			return nil
+		}
+		archive := isArchive(d.Name())
+		if archive && matchGlobs(opts.Exclude, rel) || !archive && !selected(opts, defaultInclude, rel) {
+			return nil
+		}
+		if keep != nil {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !keep(p, info) {
+				return nil
+			}
+		}
+
+		if archive {
+			if tmpDir == "" {
+				if tmpDir, err = os.MkdirTemp("", "ainvil-archive-"); err != nil {
+					return err
+				}
+			}
+			members, err := extractArchive(p, tmpDir, copies, func(member string) bool {
+				return selected(opts, defaultInclude, member)
+			})
+			copies += len(members)
+			if err != nil {
+				abs, _ := filepath.Abs(p)
+				files = append(files, sourceFile{Path: p, Name: abs, Err: fmt.Errorf("reading archive: %w", err)})
+				return nil
+			}
+			files = append(files, members...)
+			return nil
+		}
+
+		files = append(files, localSources([]string{p})...)
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+	return files, cleanup, nil
+}
+
+// extractArchive copies the regular files in archivePath that want accepts
+// into tmpDir. seq numbers the copies so that members sharing a base name
+// cannot collide; only the base name is kept on disk, so hostile member
+// paths such as "../../etc/passwd" never leave tmpDir. Each copy keeps the
+// member's modification time, which some parsers use as a start time. On
+// error the copies made so far are returned with it.
+func extractArchive(archivePath, tmpDir string, seq int, want func(member string) bool) ([]sourceFile, error) {
+	abs, _ := filepath.Abs(archivePath)
+	var files []sourceFile
+
+	add := func(member string, r io.Reader, modTime time.Time) error {
+		member = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(member)), "/")
+		if member == "" || hiddenPath(member) || !want(member) {
+			return nil
+		}
+		dir := filepath.Join(tmpDir, fmt.Sprintf("%06d", seq+len(files)))
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, path.Base(member))
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if !modTime.IsZero() {
+			os.Chtimes(dst, modTime, modTime)
+		}
+		files = append(files, sourceFile{Path: dst, Name: abs + archiveSep + member})
+		return nil
+	}
+
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, zf := range zr.File {
+			if !zf.Mode().IsRegular() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return files, err
+			}
+			err = add(zf.Name, rc, zf.Modified)
+			rc.Close()
+			if err != nil {
+				return files, err
+			}
+		}
+		return files, nil
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(archivePath), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := add(hdr.Name, tr, hdr.ModTime); err != nil {
+			return files, err
+		}
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchGlobs(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{[]string{"*.txt"}, "bee.txt", true},
+		{[]string{"*.txt"}, "2025/06/bee.txt", true},
+		{[]string{"*.txt"}, "bee.md", false},
+		{[]string{"drafts/*"}, "drafts/bee.txt", true},
+		{[]string{"drafts/*"}, "old/drafts/bee.txt", false},
+		{[]string{"*/drafts/*"}, "old/drafts/bee.txt", true},
+		{[]string{"*.md", "bee_*"}, "2025/bee_1.txt", true},
+		{nil, "bee.txt", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlobs(tt.patterns, tt.rel); got != tt.want {
+			t.Errorf("matchGlobs(%q, %q): got %v, want %v", tt.patterns, tt.rel, got, tt.want)
+		}
+	}
+
+	if err := ValidateGlobs([]string{"*.txt", "[a-"}); err == nil {
+		t.Error("ValidateGlobs accepted a malformed pattern")
+	}
+}
+
+// writeTree creates the given files, with placeholder content, below dir.
+func writeTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// collectRel returns the names collectSources finds below dir, relative to
+// dir.
+func collectRel(t *testing.T, dir string, opts ImportOptions, defaultInclude []string) []string {
+	t.Helper()
+	files, cleanup, err := collectSources(dir, opts, defaultInclude, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	abs, _ := filepath.Abs(dir)
+	var names []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(abs, f.Name)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCollectSourcesFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir,
+		"top.txt",
+		"notes.md",
+		"2025/06/nested.txt",
+		"drafts/draft.txt",
+		".hidden/secret.txt",
+		".dotfile.txt",
+	)
+	txt := []string{"*.txt"}
+
+	tests := []struct {
+		name string
+		opts ImportOptions
+		want []string
+	}{
+		{"top level only", ImportOptions{}, []string{"top.txt"}},
+		{"recursive", ImportOptions{Recursive: true}, []string{"2025/06/nested.txt", "drafts/draft.txt", "top.txt"}},
+		{"exclude folder", ImportOptions{Recursive: true, Exclude: []string{"drafts"}}, []string{"2025/06/nested.txt", "top.txt"}},
+		{"exclude files", ImportOptions{Recursive: true, Exclude: []string{"drafts/*", "top.*"}}, []string{"2025/06/nested.txt"}},
+		{"include replaces default", ImportOptions{Recursive: true, Include: []string{"*.md"}}, []string{"notes.md"}},
+		{"include path", ImportOptions{Recursive: true, Include: []string{"2025/*/*.txt"}}, []string{"2025/06/nested.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectRel(t, dir, tt.opts, txt); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// archiveMembers are the members written into every test archive. The
+// hostile and hidden ones must never be extracted outside the temp folder.
+var archiveMembers = []string{
+	"2025/06/bee_1.txt",
+	"bee_2.txt",
+	"readme.md",
+	"../../escape.txt",
+	"/abs/rooted.txt",
+	"__MACOSX/._bee_2.txt",
+	".hidden/bee_3.txt",
+}
+
+var archiveModTime = time.Date(2025, 6, 3, 19, 15, 0, 0, time.UTC)
+
+func writeZip(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, name := range archiveMembers {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archiveModTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, name)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTar(t *testing.T, path string, gzipped bool) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if gzipped {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range archiveMembers {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(name)), ModTime: archiveModTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, name)
+	}
+	// A symlink pointing out of the archive is not a regular file and is
+	// skipped.
+	tw.WriteHeader(&tar.Header{Name: "link.txt", Linkname: "/etc/passwd", Typeflag: tar.TypeSymlink})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectSourcesArchives(t *testing.T) {
+	for _, name := range []string{"bundle.zip", "bundle.tar.gz", "bundle.tgz", "bundle.tar"} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "src")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			archive := filepath.Join(dir, name)
+			if strings.HasSuffix(name, ".zip") {
+				writeZip(t, archive)
+			} else {
+				writeTar(t, archive, !strings.HasSuffix(name, ".tar"))
+			}
+
+			files, cleanup, err := collectSources(dir, ImportOptions{Exclude: []string{"2025/*/bee_1.txt"}}, []string{"*.txt"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			abs, _ := filepath.Abs(archive)
+			var names []string
+			var tmpDirs []string
+			for _, f := range files {
+				names = append(names, strings.TrimPrefix(f.Name, abs+archiveSep))
+				if !strings.HasPrefix(f.Name, abs+archiveSep) {
+					t.Errorf("%s is not named after its archive", f.Name)
+				}
+				data, err := os.ReadFile(f.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasSuffix(string(data), filepath.Base(f.Path)) {
+					t.Errorf("%s holds %q", f.Path, data)
+				}
+				if info, err := os.Stat(f.Path); err == nil && !info.ModTime().Equal(archiveModTime) {
+					t.Errorf("%s: got mtime %v, want %v", f.Name, info.ModTime(), archiveModTime)
+				}
+				tmpDirs = append(tmpDirs, filepath.Dir(filepath.Dir(f.Path)))
+			}
+			sort.Strings(names)
+			want := []string{"abs/rooted.txt", "bee_2.txt", "escape.txt"}
+			if !reflect.DeepEqual(names, want) {
+				t.Errorf("got members %q, want %q", names, want)
+			}
+
+			for _, escaped := range []string{filepath.Join(root, "escape.txt"), filepath.Join(dir, "escape.txt")} {
+				if _, err := os.Stat(escaped); !os.IsNotExist(err) {
+					t.Errorf("hostile member written to %s", escaped)
+				}
+			}
+
+			cleanup()
+			for _, tmp := range tmpDirs {
+				if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+					t.Errorf("cleanup left %s behind", tmp)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectSourcesBadArchives(t *testing.T) {
+	silenceStdout(t)
+	dir := t.TempDir()
+
+	// A gzipped tar cut off part way through, with members copied before
+	// the error, then a good zip whose copies must not collide with them,
+	// then a file that only claims to be a zip.
+	cut := filepath.Join(dir, "a_cut.tar.gz")
+	writeTar(t, cut, true)
+	data, err := os.ReadFile(cut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cut, data[:len(data)*3/4], 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, filepath.Join(dir, "b_good.zip"))
+	writeTree(t, dir, "c_bad.zip", "d_plain.txt")
+
+	files, cleanup, err := collectSources(dir, ImportOptions{}, []string{"*.txt"}, nil)
+	if err != nil {
+		t.Fatalf("a bad archive stopped the walk: %v", err)
+	}
+	defer cleanup()
+
+	abs, _ := filepath.Abs(dir)
+	var names, bad []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(abs, f.Name)
+		if f.Err != nil {
+			bad = append(bad, filepath.ToSlash(rel))
+			continue
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if want := []string{"a_cut.tar.gz", "c_bad.zip"}; !reflect.DeepEqual(bad, want) {
+		t.Errorf("got bad archives %q, want %q", bad, want)
+	}
+	sort.Strings(names)
+	want := []string{
+		"b_good.zip" + archiveSep + "2025/06/bee_1.txt",
+		"b_good.zip" + archiveSep + "abs/rooted.txt",
+		"b_good.zip" + archiveSep + "bee_2.txt",
+		"b_good.zip" + archiveSep + "escape.txt",
+		"d_plain.txt",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+
+	out := t.TempDir()
+	opts := ImportOptions{PlanOutput: filepath.Join(t.TempDir(), "plan.json")}
+	if _, err := processFiles(context.Background(), files, out, opts, beeResolver); err != nil {
+		t.Fatal(err)
+	}
+	rejected := map[string]string{}
+	for _, e := range readPlan(t, opts.PlanOutput).Entries {
+		if e.Action == ActionReject {
+			rejected[e.Source] = e.Reason
+		}
+	}
+	for _, name := range bad {
+		if reason := rejected[filepath.Join(abs, name)]; !strings.HasPrefix(reason, "reading archive: ") {
+			t.Errorf("%s: got reject reason %q", name, reason)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestVersion = 1
+
+// Manifest indexes an output tree. It is kept in out/.ainvil/state.json so
+// that incremental imports, stats and serve can work from what is already
+// known instead of re-reading every export. Everything in it except the
+// source file checksums can be rebuilt from the tree with RebuildManifest,
+// which is what "ainvil reindex" does.
+type Manifest struct {
+	Version   int    `json:"version"`
+	UpdatedAt string `json:"updatedAt"`
+	// Sources holds the sync state of each source type.
+	Sources map[string]*SourceState `json:"sources"`
+	// Files maps each imported source file, as recorded in SourceFile, to
+	// its checksum and the entry it produced.
+	Files map[string]SourceFileState `json:"files"`
+	// Entries maps the slash separated path of each export, relative to
+	// the output root, to a summary of it.
+	Entries map[string]ManifestEntry `json:"entries"`
+
+	// byID indexes Entries by source type and ID.
+	byID  map[entryID]map[string]bool
+	dirty bool
+}
+
+// entryID identifies an export independently of where it is filed.
+type entryID struct {
+	sourceType, id string
+}
+
+// SourceState is the sync state of one source type.
+type SourceState struct {
+	// LastSync is when an import of this source last finished.
+	LastSync string `json:"lastSync,omitempty"`
+	// Cursor is the newest updatedAt seen from this source, in RFC3339.
+	// Incremental API syncs start from it.
+	Cursor string `json:"cursor,omitempty"`
+	// Checkpoint is where an interrupted sync left off.
+	Checkpoint *SyncCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// SyncCheckpoint is the position of a paginated API sync after its last
+// successful page.
+type SyncCheckpoint struct {
+	// Query holds the encoded query parameters of the sync, without the
+	// page cursor.
+	Query string `json:"query"`
+	// Cursor fetches the next page.
+	Cursor string `json:"cursor"`
+	// Page is the number of the next page, for progress output.
+	Page    int    `json:"page"`
+	SavedAt string `json:"savedAt"`
+}
+
+// SourceFileState records an imported source file.
+type SourceFileState struct {
+	// Checksum is the hex SHA-256 of the file's content.
+	Checksum string `json:"checksum"`
+	// Entry is the manifest key of the export made from it.
+	Entry string `json:"entry"`
+	// ExportVersion is the ainvil version that parsed it. A newer version
+	// parses the file again.
+	ExportVersion string `json:"exportVersion"`
+	// Zone is the timezone its times were read in. The file is parsed
+	// again once --tz or --source-tz select another one.
+	Zone string `json:"zone,omitempty"`
+}
+
+// ManifestEntry summarizes one export in the tree.
+type ManifestEntry struct {
+	SourceType string `json:"sourceType"`
+	ID         string `json:"id"`
+	Title      string `json:"title,omitempty"`
+	StartTime  string `json:"startTime,omitempty"`
+	UpdatedAt  string `json:"updatedAt,omitempty"`
+	SourceFile string `json:"sourceFile,omitempty"`
+}
+
+func newManifest() *Manifest {
+	return &Manifest{
+		Version: manifestVersion,
+		Sources: map[string]*SourceState{},
+		Files:   map[string]SourceFileState{},
+		Entries: map[string]ManifestEntry{},
+		byID:    map[entryID]map[string]bool{},
+	}
+}
+
+func manifestPath(outRoot string) string {
+	return filepath.Join(outRoot, stateDir, "state.json")
+}
+
+// OpenManifest loads the manifest of outRoot. An output tree written before
+// manifests existed has none; its manifest is then rebuilt from the tree and
+// marked for saving by the next command that writes to it.
+func OpenManifest(outRoot string) (*Manifest, error) {
+	m, err := loadManifest(outRoot)
+	if errors.Is(err, fs.ErrNotExist) {
+		if m, err = RebuildManifest(outRoot, nil); err != nil {
+			return nil, err
+		}
+		m.dirty = true
+	}
+	return m, err
+}
+
+// loadManifest reads the manifest file of outRoot.
+func loadManifest(outRoot string) (*Manifest, error) {
+	path := manifestPath(outRoot)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newManifest()
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("reading %s: %w (run \"ainvil reindex\" to rebuild it)", path, err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("%s was written by a newer version of ainvil", path)
+	}
+	for key, e := range m.Entries {
+		m.index(key, e)
+	}
+	return m, nil
+}
+
+// RebuildManifest indexes every export below outRoot. Source file checksums
+// cannot be recovered from the tree; those in prev, if given, are kept for
+// entries that still exist, and the other source files are parsed once more
+// on their next import. The LastSync times and checkpoints of prev are kept
+// too.
+func RebuildManifest(outRoot string, prev *Manifest) (*Manifest, error) {
+	m := newManifest()
+	err := filepath.WalkDir(outRoot, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == outRoot {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != outRoot && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var export PendantExport
+		if err := json.Unmarshal(data, &export); err != nil || export.SourceType == "" {
+			return nil
+		}
+		m.addEntry(outRoot, path, &export)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if prev != nil {
+		for source, state := range prev.Sources {
+			m.source(source).LastSync = state.LastSync
+			m.source(source).Checkpoint = state.Checkpoint
+		}
+		for name, f := range prev.Files {
+			if _, ok := m.Entries[f.Entry]; ok {
+				m.Files[name] = f
+			}
+		}
+	}
+	return m, nil
+}
+
+// Save writes the manifest into outRoot if it has changed. The caller must
+// hold the lock on outRoot.
+func (m *Manifest) Save(outRoot string) error {
+	if !m.dirty {
+		return nil
+	}
+	m.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	path := manifestPath(outRoot)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, toJSON(m), 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	m.dirty = false
+	return nil
+}
+
+func (m *Manifest) source(sourceType string) *SourceState {
+	s, ok := m.Sources[sourceType]
+	if !ok {
+		s = &SourceState{}
+		m.Sources[sourceType] = s
+	}
+	return s
+}
+
+// Cursor returns the newest updatedAt seen from sourceType, or the zero
+// time if there is none.
+func (m *Manifest) Cursor(sourceType string) time.Time {
+	s, ok := m.Sources[sourceType]
+	if !ok {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, s.Cursor)
+	return t
+}
+
+// manifestKey is the manifest key of the export at path.
+func manifestKey(outRoot, path string) string {
+	rel, err := filepath.Rel(outRoot, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// EntryDate returns the day the export with the given manifest key is filed
+// under, YYYY/MM/DD/<file>. Exports under undated/ have none.
+func EntryDate(key string) (time.Time, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 4 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("2006/01/02", strings.Join(parts[:3], "/"))
+	return t, err == nil
+}
+
+// SourceStats counts the exports of one source type.
+type SourceStats struct {
+	Count int
+	// Undated is how many of them are filed under undated/.
+	Undated int
+	// Latest is the newest day with an export, zero if all are undated.
+	Latest time.Time
+}
+
+// Stats counts the exports in the manifest per source type.
+func (m *Manifest) Stats() map[string]*SourceStats {
+	stats := map[string]*SourceStats{}
+	for key, e := range m.Entries {
+		s, ok := stats[e.SourceType]
+		if !ok {
+			s = &SourceStats{}
+			stats[e.SourceType] = s
+		}
+		s.Count++
+		date, ok := EntryDate(key)
+		if !ok {
+			s.Undated++
+		} else if date.After(s.Latest) {
+			s.Latest = date
+		}
+	}
+	return stats
+}
+
+// addEntry records the export saved at path and advances its source's
+// cursor.
+func (m *Manifest) addEntry(outRoot, path string, export *PendantExport) string {
+	key := manifestKey(outRoot, path)
+	if old, ok := m.Entries[key]; ok {
+		m.unindex(key, old)
+	}
+	e := ManifestEntry{
+		SourceType: export.SourceType,
+		ID:         export.ID,
+		Title:      export.Title,
+		StartTime:  export.StartTime,
+		UpdatedAt:  export.UpdatedAt,
+		SourceFile: export.SourceFile,
+	}
+	m.Entries[key] = e
+	m.index(key, e)
+	if t, err := time.Parse(time.RFC3339, export.UpdatedAt); err == nil && t.After(m.Cursor(export.SourceType)) {
+		m.source(export.SourceType).Cursor = t.UTC().Format(time.RFC3339)
+	}
+	m.dirty = true
+	return key
+}
+
+// removeEntry forgets the export at path.
+func (m *Manifest) removeEntry(outRoot, path string) {
+	key := manifestKey(outRoot, path)
+	if e, ok := m.Entries[key]; ok {
+		delete(m.Entries, key)
+		m.unindex(key, e)
+		m.dirty = true
+	}
+}
+
+func (m *Manifest) index(key string, e ManifestEntry) {
+	id := entryID{e.SourceType, e.ID}
+	if m.byID[id] == nil {
+		m.byID[id] = map[string]bool{}
+	}
+	m.byID[id][key] = true
+}
+
+func (m *Manifest) unindex(key string, e ManifestEntry) {
+	id := entryID{e.SourceType, e.ID}
+	delete(m.byID[id], key)
+	if len(m.byID[id]) == 0 {
+		delete(m.byID, id)
+	}
+}
+
+// entriesWithID returns the keys of the exports of sourceType with the
+// given ID, sorted.
+func (m *Manifest) entriesWithID(sourceType, id string) []string {
+	keys := make([]string, 0, len(m.byID[entryID{sourceType, id}]))
+	for key := range m.byID[entryID{sourceType, id}] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// synced records that an import of sourceType has just finished.
+func (m *Manifest) synced(sourceType string) {
+	m.source(sourceType).LastSync = time.Now().UTC().Format(time.RFC3339)
+	m.dirty = true
+}
+
+// unchangedSource reports whether the source file name with the given
+// checksum was already imported by this version of ainvil, in the zone now
+// configured for its source, into an entry that is still in the tree, and
+// returns that entry's key.
+func (m *Manifest) unchangedSource(outRoot, name, checksum string) (string, bool) {
+	f, ok := m.Files[name]
+	if !ok || f.Checksum != checksum || f.ExportVersion != GetVersion() {
+		return "", false
+	}
+	e, ok := m.Entries[f.Entry]
+	if !ok || f.Zone != SourceLocation(e.SourceType).String() {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(outRoot, filepath.FromSlash(f.Entry))); err != nil {
+		return "", false
+	}
+	return f.Entry, true
+}
+
+// updateManifest applies fn to the manifest of outRoot and saves it. The
+// caller must hold the lock on outRoot.
+func updateManifest(outRoot string, fn func(m *Manifest)) error {
+	m, err := OpenManifest(outRoot)
+	if err != nil {
+		return err
+	}
+	fn(m)
+	return m.Save(outRoot)
+}
+
+// Reindex rebuilds the manifest of outRoot from the exports in it, and
+// removes temp files orphaned anywhere in the tree.
+func Reindex(outRoot string) (*Manifest, error) {
+	lock, err := LockOutDir(outRoot, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	if n, err := cleanAllTempFiles(outRoot); err != nil {
+		fmt.Println("Warning: cleaning temp files:", err)
+	} else if n > 0 {
+		fmt.Printf("Removed %d temp file(s) left by an interrupted run\n", n)
+	}
+	return reindex(outRoot)
+}
+
+// reindex is Reindex for callers already holding the lock. A damaged
+// manifest is simply replaced.
+func reindex(outRoot string) (*Manifest, error) {
+	prev, _ := loadManifest(outRoot)
+	m, err := RebuildManifest(outRoot, prev)
+	if err != nil {
+		return nil, err
+	}
+	m.dirty = true
+	if err := m.Save(outRoot); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fileChecksum returns the hex SHA-256 of the file at path.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// importBeeFixtures imports paths into out and returns the plan entries and
+// how often each file was parsed.
+func importBeeFixtures(t *testing.T, paths []string, out string, opts ImportOptions) ([]PlanEntry, *countingResolver) {
+	t.Helper()
+	r := newCountingResolver()
+	entries, err := processFiles(context.Background(), localSources(paths), out, opts, r.resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries, r
+}
+
+func TestManifestSkipsUnchangedSources(t *testing.T) {
+	silenceStdout(t)
+	paths := writeBeeFixtures(t, t.TempDir(), 3)
+	out := t.TempDir()
+
+	importBeeFixtures(t, paths, out, ImportOptions{})
+	entries, r := importBeeFixtures(t, paths, out, ImportOptions{})
+	for i, e := range entries {
+		name := filepath.Base(paths[i])
+		if e.Action != ActionIdentical || e.Reason != "source file unchanged since last import" || r.count(name) != 0 {
+			t.Errorf("%s: got %s (%s) after %d parses, want it skipped", name, e.Action, e.Reason, r.count(name))
+		}
+	}
+
+	// A changed file is parsed again, the others are not.
+	data, _ := os.ReadFile(paths[1])
+	if err := os.WriteFile(paths[1], append(data, "Speaker 1: One more thing.\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, r = importBeeFixtures(t, paths, out, ImportOptions{})
+	if r.count(filepath.Base(paths[1])) != 1 || r.count(filepath.Base(paths[0])) != 0 {
+		t.Errorf("got parses %v, want only the changed file", r.calls)
+	}
+	if entries[1].Action != ActionCreate {
+		t.Errorf("changed file: got %s, want create", entries[1].Action)
+	}
+
+	// --overwrite-policy overwrite parses everything.
+	_, r = importBeeFixtures(t, paths, out, ImportOptions{Policy: PolicyOverwrite})
+	for _, p := range paths {
+		if r.count(filepath.Base(p)) != 1 {
+			t.Errorf("overwrite: %s parsed %d times, want 1", p, r.count(filepath.Base(p)))
+		}
+	}
+
+	// A file whose export was deleted is imported again.
+	m, err := OpenManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(paths[0])
+	gone := filepath.Join(out, filepath.FromSlash(m.Files[abs].Entry))
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = importBeeFixtures(t, paths, out, ImportOptions{})
+	if entries[0].Action != ActionCreate || entries[0].Target != gone {
+		t.Errorf("deleted export: got %s -> %s, want create -> %s", entries[0].Action, entries[0].Target, gone)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	silenceStdout(t)
+	paths := writeBeeFixtures(t, t.TempDir(), 3)
+	out := t.TempDir()
+	importBeeFixtures(t, paths, out, ImportOptions{})
+
+	before, err := OpenManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete one export and add another by hand.
+	abs0, _ := filepath.Abs(paths[0])
+	deleted := before.Files[abs0].Entry
+	if err := os.Remove(filepath.Join(out, filepath.FromSlash(deleted))); err != nil {
+		t.Fatal(err)
+	}
+	added := &PendantExport{ID: "by-hand", SourceType: "omi", StartTime: "2025-01-02T03:04:05Z", Title: "Copied in"}
+	if err := writeExport(exportPath(out, added), added); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Reindex(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Entries[deleted]; ok {
+		t.Errorf("deleted export %s still indexed", deleted)
+	}
+	if e, ok := m.Entries["2025/01/02/omi_by-hand.json"]; !ok || e.Title != "Copied in" {
+		t.Errorf("export added by hand not indexed: %+v", m.Entries)
+	}
+	if len(m.Entries) != 3 {
+		t.Errorf("got %d entries, want 3", len(m.Entries))
+	}
+
+	// Checksums of exports still in the tree survive; the deleted one's
+	// source is imported again.
+	if _, ok := m.Files[abs0]; ok {
+		t.Errorf("checksum of %s kept although its export is gone", abs0)
+	}
+	for _, p := range paths[1:] {
+		abs, _ := filepath.Abs(p)
+		if !reflect.DeepEqual(m.Files[abs], before.Files[abs]) {
+			t.Errorf("%s: got %+v, want %+v", abs, m.Files[abs], before.Files[abs])
+		}
+	}
+	if m.Sources["bee"] == nil || m.Sources["bee"].LastSync != before.Sources["bee"].LastSync {
+		t.Errorf("last sync not kept: %+v", m.Sources["bee"])
+	}
+
+	entries, r := importBeeFixtures(t, paths, out, ImportOptions{})
+	if r.count(filepath.Base(paths[0])) != 1 || r.count(filepath.Base(paths[1])) != 0 || r.count(filepath.Base(paths[2])) != 0 {
+		t.Errorf("got parses %v, want only the file whose export was deleted", r.calls)
+	}
+	if entries[0].Action != ActionCreate {
+		t.Errorf("got %s, want create", entries[0].Action)
+	}
+
+	// A damaged manifest is replaced.
+	if err := os.WriteFile(manifestPath(out), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenManifest(out); err == nil {
+		t.Error("expected an error reading a damaged manifest")
+	}
+	if m, err = Reindex(out); err != nil || len(m.Entries) != 4 {
+		t.Fatalf("reindex of a damaged manifest: got %d entries, %v", len(m.Entries), err)
+	}
+}
+
+func TestOpenManifestIndexesOldTree(t *testing.T) {
+	out := t.TempDir()
+	for _, e := range []*PendantExport{
+		{ID: "a", SourceType: "bee", StartTime: "2025-06-03T19:15:00Z"},
+		{ID: "b", SourceType: "bee", StartTime: "not a time"},
+	} {
+		flagUnparsedTimes(e)
+		if err := writeExport(exportPath(out, e), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files that are not exports are ignored.
+	os.WriteFile(filepath.Join(out, "notes.json"), []byte(`{"hello": "world"}`), 0644)
+
+	m, err := OpenManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 2 || m.Entries["2025/06/03/bee_a.json"].ID != "a" || m.Entries["undated/bee_b.json"].ID != "b" {
+		t.Errorf("got entries %v", m.Entries)
+	}
+	if _, err := os.Stat(manifestPath(out)); !os.IsNotExist(err) {
+		t.Error("opening a manifest must not write it")
+	}
+}
+
+func TestManifestIndexByID(t *testing.T) {
+	out := t.TempDir()
+	m := newManifest()
+	a := &PendantExport{ID: "x", SourceType: "bee"}
+	m.addEntry(out, filepath.Join(out, "2025", "06", "03", "bee_x.json"), a)
+	m.addEntry(out, filepath.Join(out, "2025", "06", "04", "bee_x.json"), a)
+	m.addEntry(out, filepath.Join(out, "2025", "06", "04", "omi_x.json"), &PendantExport{ID: "x", SourceType: "omi"})
+
+	if got := m.entriesWithID("bee", "x"); !reflect.DeepEqual(got, []string{"2025/06/03/bee_x.json", "2025/06/04/bee_x.json"}) {
+		t.Errorf("got %v", got)
+	}
+
+	m.removeEntry(out, filepath.Join(out, "2025", "06", "03", "bee_x.json"))
+	// An entry replaced by an export with another ID moves in the index.
+	m.addEntry(out, filepath.Join(out, "2025", "06", "04", "bee_x.json"), &PendantExport{ID: "y", SourceType: "bee"})
+	if got := m.entriesWithID("bee", "x"); len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+	if got := m.entriesWithID("bee", "y"); !reflect.DeepEqual(got, []string{"2025/06/04/bee_x.json"}) {
+		t.Errorf("got %v", got)
+	}
+
+	// The index is rebuilt when the manifest is loaded.
+	m.dirty = true
+	if err := m.Save(out); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.byID, m.byID) {
+		t.Errorf("got index %v, want %v", loaded.byID, m.byID)
+	}
+}
+
+func TestManifestStats(t *testing.T) {
+	m := newManifest()
+	m.Entries = map[string]ManifestEntry{
+		"2025/06/03/bee_a.json":       {SourceType: "bee"},
+		"2025/07/01/bee_b.json":       {SourceType: "bee"},
+		"undated/bee_c.json":          {SourceType: "bee"},
+		"undated/omi_d.json":          {SourceType: "omi"},
+		"2024/12/31/limitless_e.json": {SourceType: "limitless"},
+	}
+
+	want := map[string]*SourceStats{
+		"bee":       {Count: 3, Undated: 1, Latest: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+		"omi":       {Count: 1, Undated: 1},
+		"limitless": {Count: 1, Latest: time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	if got := m.Stats(); !reflect.DeepEqual(got, want) {
+		for k, v := range got {
+			t.Logf("%s: %+v", k, *v)
+		}
+		t.Errorf("stats differ")
+	}
+
+	for key, ok := range map[string]bool{
+		"2025/06/03/bee_a.json": true,
+		"undated/bee_c.json":    false,
+		"2025/13/03/bee_a.json": false,
+		"bee_a.json":            false,
+	} {
+		if _, got := EntryDate(key); got != ok {
+			t.Errorf("EntryDate(%q) = %v, want %v", key, got, ok)
+		}
+	}
+}
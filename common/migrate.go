@@ -0,0 +1,272 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IDMapping records one file moved by MigrateIDs.
+type IDMapping struct {
+	SourceType string `json:"sourceType"`
+	OldID      string `json:"oldId"`
+	NewID      string `json:"newId"`
+	OldPath    string `json:"oldPath"`
+	NewPath    string `json:"newPath"`
+	Duplicate  bool   `json:"duplicate,omitempty"`
+	MigratedAt string `json:"migratedAt"`
+}
+
+// MigrateIDs rewrites every file based export below outRoot to its
+// ContentID, moving it to the matching <sourceType>_<id>.json path. Limitless
+// exports already carry stable API IDs and are left alone. Bee and Omi times
+// are read again first, see refreshTimes. Every move is
+// appended to the JSON mapping file at mappingPath. When two files resolve to
+// the same ID the later one is a duplicate and is removed.
+func MigrateIDs(outRoot, mappingPath string) error {
+	lock, err := LockOutDir(outRoot, 0)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	var mappings []IDMapping
+	if data, err := os.ReadFile(mappingPath); err == nil {
+		if err := json.Unmarshal(data, &mappings); err != nil {
+			return fmt.Errorf("reading mapping file: %w", err)
+		}
+	}
+
+	var paths []string
+	err = filepath.WalkDir(outRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// .ainvil holds the manifest and history copies, which must
+			// keep their old IDs.
+			if path != outRoot && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".json") && path != mappingPath {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	migrated, unchanged := 0, 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", path, err)
+			continue
+		}
+		var export PendantExport
+		if err := json.Unmarshal(data, &export); err != nil || export.SourceType == "" {
+			continue
+		}
+		if export.SourceType == "limitless" {
+			continue
+		}
+
+		oldID := export.ID
+		refreshTimes(&export)
+		export.ID = ContentID(&export)
+		newPath := exportPath(outRoot, &export)
+		if newPath == path {
+			unchanged++
+			continue
+		}
+
+		m := IDMapping{
+			SourceType: export.SourceType,
+			OldID:      oldID,
+			NewID:      export.ID,
+			OldPath:    path,
+			NewPath:    newPath,
+			MigratedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+
+		if _, err := os.Stat(newPath); err == nil {
+			m.Duplicate = true
+		} else if err := saveExport(outRoot, &export); err != nil {
+			fmt.Printf("Error saving %s: %v\n", newPath, err)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			fmt.Printf("Error removing %s: %v\n", path, err)
+		}
+
+		mappings = append(mappings, m)
+		fmt.Printf("Migrated %s -> %s\n", path, newPath)
+		migrated++
+	}
+
+	if err := writeFileAtomic(mappingPath, toJSON(mappings), 0644); err != nil {
+		return fmt.Errorf("writing mapping file: %w", err)
+	}
+	if migrated > 0 {
+		if _, err := reindex(outRoot); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Done. %d files migrated, %d already up to date. Mapping written to %s\n", migrated, unchanged, mappingPath)
+	return nil
+}
+
+// refreshTimes reads the start and end time of a Bee or Omi export again
+// the way the importers do now, so that its ContentID matches the one a
+// re-import produces. Older versions kept Omi's "Memory from" text unparsed
+// and read Bee times as UTC. The source file is parsed again if it still
+// exists, otherwise the times are rebuilt from Raw.
+func refreshTimes(export *PendantExport) {
+	var parse ParserFunc
+	switch export.SourceType {
+	case "bee":
+		parse = ParseBeeFile
+	case "omi":
+		parse = ParseOmiFile
+	default:
+		return
+	}
+
+	if _, err := os.Stat(export.SourceFile); export.SourceFile != "" && err == nil {
+		if fresh, err := parse(export.SourceFile); err == nil {
+			export.StartTime, export.EndTime = fresh.StartTime, fresh.EndTime
+			return
+		}
+	}
+
+	if export.SourceType == "omi" {
+		var text string
+		if json.Unmarshal(export.Raw, &text) != nil {
+			return
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "Memory from "); ok {
+				export.StartTime, export.EndTime = parseOmiTimestamp(strings.TrimSpace(rest))
+				return
+			}
+		}
+		return
+	}
+
+	var raw struct{ StartTime, EndTime string }
+	if json.Unmarshal(export.Raw, &raw) != nil || raw.StartTime == "" {
+		return
+	}
+	export.StartTime = beeWallClock(raw.StartTime)
+	if raw.EndTime != "" {
+		export.EndTime = beeWallClock(raw.EndTime)
+	}
+}
+
+// beeWallClock converts a Bee time saved by an older version, which read
+// the header's wall clock time as UTC, into Bee's zone. Times with another
+// offset were already normalized and are only moved into the current zone.
+func beeWallClock(saved string) string {
+	t, err := time.Parse(time.RFC3339, saved)
+	if err != nil {
+		return parseBeeTimestamp(saved)
+	}
+	if _, offset := t.Zone(); offset != 0 {
+		return normalizeOrRaw("bee", saved)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, SourceLocation("bee")).Format(time.RFC3339)
+}
+
+// MigrateSchema rebuilds the Limitless exports below outRoot from the API
+// response kept in their raw field, so files written by older versions get
+// the current mapping: real end times, nested content, location, tags and
+// device type. Files go through an ExportWriter, so dry runs, plans, the
+// overwrite policy and --keep-history all apply, and an export whose
+// corrected start time falls on another day is moved there.
+func MigrateSchema(outRoot string, opts ImportOptions) error {
+	w, err := NewExportWriter(outRoot, opts)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, key := range w.entryKeys("limitless") {
+		path := filepath.Join(outRoot, filepath.FromSlash(key))
+		export, err := rebuildLimitlessExport(path)
+		if err != nil {
+			w.Reject(path, "limitless", err)
+			if !opts.DryRun {
+				fmt.Printf("Skipping %s: %v\n", path, err)
+			}
+			continue
+		}
+
+		entry, err := w.Save(path, export)
+		if err != nil {
+			fmt.Printf("Error saving %s: %v\n", path, err)
+			continue
+		}
+		if !opts.DryRun {
+			printSaved(filepath.Base(path), entry)
+		}
+	}
+
+	return w.Finish()
+}
+
+// rebuildLimitlessExport maps the raw lifelog saved in the export at path
+// again. The export's original SourceFile is kept.
+func rebuildLimitlessExport(path string) (*PendantExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var old PendantExport
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, err
+	}
+	if len(old.Raw) == 0 || string(old.Raw) == "null" {
+		return nil, fmt.Errorf("no raw lifelog to rebuild from")
+	}
+
+	var item LimitlessLifelog
+	if err := json.Unmarshal(old.Raw, &item); err != nil {
+		return nil, fmt.Errorf("malformed raw lifelog: %w", err)
+	}
+	item.Raw = old.Raw
+
+	export := item.ToPendantExport()
+	if old.SourceFile != "" {
+		export.SourceFile = old.SourceFile
+	}
+	return export, nil
+}
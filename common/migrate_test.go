@@ -0,0 +1,370 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLegacyExport saves export under its current, random ID, as versions
+// before content IDs did.
+func writeLegacyExport(t *testing.T, outRoot string, export PendantExport) string {
+	t.Helper()
+	path := exportPath(outRoot, &export)
+	if err := writeExport(path, &export); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateIDs(t *testing.T) {
+	silenceStdout(t)
+	out := t.TempDir()
+	mappingPath := filepath.Join(t.TempDir(), "mapping.json")
+
+	bee := PendantExport{ID: "random-1", SourceType: "bee", StartTime: "2025-06-03T19:15:00Z", Transcript: "Speaker 1: Tacos."}
+	oldPath := writeLegacyExport(t, out, bee)
+	dup := bee
+	dup.ID = "random-2"
+	dupPath := writeLegacyExport(t, out, dup)
+	lifelog := PendantExport{ID: "ll-1", SourceType: "limitless", StartTime: "2025-06-03T08:00:00Z", Transcript: "hi"}
+	lifelogPath := writeLegacyExport(t, out, lifelog)
+
+	// A history copy of the export as it will be after migration must
+	// survive, even though its content ID already exists in the tree.
+	migrated := bee
+	migrated.ID = ContentID(&migrated)
+	historyPath := filepath.Join(out, stateDir, "history", "bee", migrated.ID, "2025-06-03T19-15-00Z.json")
+	if err := writeExport(historyPath, &migrated); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateIDs(out, mappingPath); err != nil {
+		t.Fatal(err)
+	}
+
+	newPath := exportPath(out, &migrated)
+	for _, p := range []string{newPath, lifelogPath, historyPath} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s should exist: %v", p, err)
+		}
+	}
+	for _, p := range []string{oldPath, dupPath} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s should have been moved", p)
+		}
+	}
+
+	var mappings []IDMapping
+	data, err := os.ReadFile(mappingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("got %d mappings, want 2: %+v", len(mappings), mappings)
+	}
+	dups := 0
+	for _, m := range mappings {
+		if m.NewID != migrated.ID || m.NewPath != newPath || m.SourceType != "bee" {
+			t.Errorf("unexpected mapping %+v", m)
+		}
+		if m.Duplicate {
+			dups++
+		}
+	}
+	if dups != 1 {
+		t.Errorf("got %d duplicates, want 1", dups)
+	}
+
+	// A second run has nothing to do and keeps the earlier mappings.
+	if err := MigrateIDs(out, mappingPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(mappingPath)
+	var again []IDMapping
+	json.Unmarshal(data, &again)
+	if len(again) != 2 {
+		t.Errorf("second run changed the mapping file: %d entries", len(again))
+	}
+	if _, err := os.Stat(historyPath); err != nil {
+		t.Errorf("history copy removed on second run: %v", err)
+	}
+}
+
+// writeBaselineExports saves bee.txt and omi.txt from testdata/mixed the way
+// the first release did: IDs are the file name stems and files are named
+// <id>.json, Omi's "Memory from" text is kept unparsed, so the file lands in
+// today's folder, and Bee's wall clock time is read as UTC. The exports
+// record sourceDir as the folder they were imported from.
+func writeBaselineExports(t *testing.T, outRoot, sourceDir string) {
+	t.Helper()
+	omiText, err := os.ReadFile(filepath.Join("testdata", "mixed", "omi.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	omiRaw, _ := json.Marshal(string(omiText))
+	beeRaw, _ := json.Marshal(map[string]any{
+		"StartTime":          "2025-06-03T19:15:00Z",
+		"EndTime":            "2025-06-03T19:45:00Z",
+		"DeviceType":         "Bee Pioneer",
+		"ShortSummary":       "Dinner planning",
+		"SummaryLines":       []string{"Talked about dinner."},
+		"TranscriptionLines": []string{"Speaker 1: What should we eat?", "Speaker 2: Tacos."},
+	})
+
+	today := time.Now().UTC().Format("2006/01/02")
+	for rel, export := range map[string]PendantExport{
+		"2025/06/03/bee.json": {
+			ID: "bee", SourceType: "bee", SourceFile: filepath.Join(sourceDir, "bee.txt"),
+			StartTime: "2025-06-03T19:15:00Z", EndTime: "2025-06-03T19:45:00Z",
+			Title: "Dinner planning", Transcript: "Speaker 1: What should we eat?\nSpeaker 2: Tacos.",
+			Raw: beeRaw,
+		},
+		today + "/omi.json": {
+			ID: "omi", SourceType: "omi", SourceFile: filepath.Join(sourceDir, "omi.txt"),
+			StartTime: "Jun 4, 2025 at 9:00 AM to 9:30 AM",
+			Title:     "Standup", Transcript: "Speaker 0: Morning all.\nSpeaker 1: Morning.",
+			Raw: omiRaw,
+		},
+	} {
+		if err := writeExport(filepath.Join(outRoot, filepath.FromSlash(rel)), &export); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateIDsBaselineThenReimport(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		keepSource bool
+	}{
+		{"from source files", true},
+		{"from raw", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pinTimezones(t, "America/Los_Angeles")
+			silenceStdout(t)
+
+			src := t.TempDir()
+			for _, name := range []string{"bee.txt", "omi.txt"} {
+				data, err := os.ReadFile(filepath.Join("testdata", "mixed", name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(src, name), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			out := t.TempDir()
+			recorded := src
+			if !tc.keepSource {
+				recorded = filepath.Join(t.TempDir(), "gone")
+			}
+			writeBaselineExports(t, out, recorded)
+
+			if err := MigrateIDs(out, filepath.Join(t.TempDir(), "mapping.json")); err != nil {
+				t.Fatal(err)
+			}
+
+			planPath := filepath.Join(t.TempDir(), "plan.json")
+			if err := ImportMixedExports(context.Background(), src, out, ImportOptions{PlanOutput: planPath}); err != nil {
+				t.Fatal(err)
+			}
+			plan := readPlan(t, planPath)
+			if len(plan.Entries) != 2 {
+				t.Fatalf("got %d plan entries, want 2: %+v", len(plan.Entries), plan.Entries)
+			}
+			for _, e := range plan.Entries {
+				if e.Action == ActionCreate {
+					t.Errorf("re-import created %s, migrated copy not found", e.Target)
+				}
+			}
+
+			var files []string
+			filepath.WalkDir(out, func(path string, d fs.DirEntry, err error) error {
+				if d.IsDir() && d.Name() == stateDir {
+					return filepath.SkipDir
+				}
+				if strings.HasSuffix(path, ".json") {
+					rel, _ := filepath.Rel(out, path)
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if len(files) != 2 {
+				t.Fatalf("got %v, want one bee and one omi export", files)
+			}
+			for _, rel := range files {
+				if !strings.HasPrefix(rel, "2025/06/") {
+					t.Errorf("%s is not in its June 2025 day folder", rel)
+				}
+			}
+		})
+	}
+}
+
+// captureStdout returns what fn prints.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	return <-done
+}
+
+// baselineLifelog is a Limitless API lifelog that starts in the evening of
+// June 3 in Los Angeles, which is June 4 in UTC.
+const baselineLifelog = `{
+  "id": "abc",
+  "title": "Evening walk",
+  "markdown": "# Evening walk",
+  "startTime": "2025-06-04T05:30:00Z",
+  "endTime": "2025-06-04T06:10:00Z",
+  "updatedAt": "2025-06-04T07:00:00Z",
+  "isStarred": true,
+  "contents": [{
+    "type": "heading1",
+    "content": "Evening walk",
+    "children": [{
+      "type": "blockquote",
+      "content": "Nice night.",
+      "speakerName": "Ann",
+      "speakerIdentifier": "user",
+      "startTime": "2025-06-04T05:31:00Z",
+      "endTime": "2025-06-04T05:31:05Z"
+    }]
+  }],
+  "location": {"latitude": 47.6, "longitude": "-122.3", "address": "Seattle"},
+  "tags": ["walk"],
+  "source": {"deviceType": "pendant"}
+}`
+
+func TestMigrateSchema(t *testing.T) {
+	pinTimezones(t, "America/Los_Angeles")
+	out := t.TempDir()
+
+	// The first release filed lifelogs by their UTC date, used updatedAt
+	// as the end time and kept only the top level content nodes.
+	var flat []ContentEntry
+	json.Unmarshal([]byte(`[{"type": "heading1", "content": "Evening walk"}]`), &flat)
+	oldPath := filepath.Join(out, "2025", "06", "04", "limitless_abc.json")
+	baseline := PendantExport{
+		ID: "abc", SourceType: "limitless", SourceFile: "limitlessAPI",
+		StartTime: "2025-06-04T05:30:00Z", EndTime: "2025-06-04T07:00:00Z", UpdatedAt: "2025-06-04T07:00:00Z",
+		Title: "Evening walk", Transcript: "# Evening walk", Contents: flat, IsStarred: true,
+		ExportVersion: "Ainvil 2.0.0", Raw: json.RawMessage(baselineLifelog),
+	}
+	if err := writeExport(oldPath, &baseline); err != nil {
+		t.Fatal(err)
+	}
+
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	var err error
+	printed := captureStdout(t, func() {
+		err = MigrateSchema(out, ImportOptions{PlanOutput: planPath})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(printed, "Error") {
+		t.Errorf("unexpected errors:\n%s", printed)
+	}
+
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("old copy at %s should have been removed: %v", oldPath, err)
+	}
+	newPath := filepath.Join(out, "2025", "06", "03", "limitless_abc.json")
+	data, err := os.ReadFile(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got PendantExport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.StartTime != "2025-06-03T22:30:00-07:00" || got.EndTime != "2025-06-03T23:10:00-07:00" {
+		t.Errorf("got %s - %s", got.StartTime, got.EndTime)
+	}
+	if got.DeviceType != "pendant" || got.Latitude != "47.6" || got.Longitude != "-122.3" || got.Address != "Seattle" {
+		t.Errorf("device or location not mapped: %+v", got)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != "walk" || got.SourceFile != "limitlessAPI" || got.Markdown != "# Evening walk" {
+		t.Errorf("got tags %v, sourceFile %q, markdown %q", got.Tags, got.SourceFile, got.Markdown)
+	}
+	if len(got.Contents) != 1 || len(got.Contents[0].Children) != 1 {
+		t.Fatalf("nested contents not kept: %+v", got.Contents)
+	}
+	child := got.Contents[0].Children[0]
+	if child.SpeakerIdentifier != "user" || child.StartTime != "2025-06-03T22:31:00-07:00" {
+		t.Errorf("got child %+v", child)
+	}
+	if got.Transcript != "Ann: Nice night." {
+		t.Errorf("got transcript %q", got.Transcript)
+	}
+
+	plan := readPlan(t, planPath)
+	if len(plan.Entries) != 1 || plan.Entries[0].Action != ActionCreate || plan.Entries[0].Reason != "moved from "+oldPath {
+		t.Errorf("got plan %+v", plan.Entries)
+	}
+
+	m, err := OpenManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Entries["2025/06/04/limitless_abc.json"]; ok || len(m.Entries) != 1 {
+		t.Errorf("manifest still lists the old copy: %v", m.Entries)
+	}
+
+	// A second run finds nothing to change.
+	planPath = filepath.Join(t.TempDir(), "plan.json")
+	silenceStdout(t)
+	if err := MigrateSchema(out, ImportOptions{PlanOutput: planPath}); err != nil {
+		t.Fatal(err)
+	}
+	if plan := readPlan(t, planPath); len(plan.Entries) != 1 || plan.Entries[0].Action != ActionIdentical {
+		t.Errorf("second run: got plan %+v", plan.Entries)
+	}
+}
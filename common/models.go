@@ -24,30 +24,16 @@ package common
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
 )
 
-type PendantExport struct {
-	ID            string          `json:"id"`
-	SourceType    string          `json:"sourceType"`
-	StartTime     string          `json:"startTime"`
-	EndTime       string          `json:"endTime"`
-	Title         string          `json:"title"`
-	Overview      string          `json:"overview"`
-	Transcript    string          `json:"transcript"`
-	Contents      []ContentEntry  `json:"contents"`
-	Markdown      string          `json:"markdown,omitempty"`
-	IsStarred     bool            `json:"isStarred,omitempty"`
-	UpdatedAt     string          `json:"updatedAt,omitempty"`
-	CreatedAt     string          `json:"createdAt,omitempty"`
-	ExportDate    string          `json:"exportDate"`
-	ExportVersion string          `json:"exportVersion"`
-	SourceFile    string          `json:"sourceFile"`
-	DeviceType    string          `json:"deviceType,omitempty"`
-	Latitude      string          `json:"latitude,omitempty"`
-	Longitude     string          `json:"longitude,omitempty"`
-	Address       string          `json:"address,omitempty"`
-	Raw           json.RawMessage `json:"raw"`
-}
+// PendantExport is the record written to the output tree. It is defined in
+// the public SDK package so other Go programs share the same type.
+type PendantExport = ainvil.Record
+
+// ContentEntry is one node of a PendantExport's structured contents.
+type ContentEntry = ainvil.Content
 
 type LimitlessResponse struct {
 	Data []LimitlessLifelog `json:"data"`
@@ -74,9 +60,31 @@ type LimitlessLifelog struct {
 }
 
 type Location struct {
-	Latitude  string `json:"latitude"`
-	Longitude string `json:"longitude"`
-	Address   string `json:"address"`
+	Latitude  Coordinate `json:"latitude"`
+	Longitude Coordinate `json:"longitude"`
+	Address   string     `json:"address"`
+}
+
+// Coordinate is a latitude or longitude. It may arrive as a JSON number or
+// a string and is kept as text either way.
+type Coordinate string
+
+func (c *Coordinate) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*c = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*c = Coordinate(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*c = Coordinate(n.String())
+	return nil
 }
 
 type Source struct {
@@ -119,15 +127,3 @@ type AinvilExport struct {
 	Raw           any            `json:"raw"`
 	Markdown      string         `json:"markdown,omitempty"`
 }
-
-type ContentEntry struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
-
-	SpeakerName       string `json:"speakerName,omitempty"`
-	SpeakerIdentifier string `json:"speakerIdentifier,omitempty"`
-	StartTime         string `json:"startTime,omitempty"`
-	EndTime           string `json:"endTime,omitempty"`
-	StartOffsetMs     int    `json:"startOffsetMs,omitempty"`
-	EndOffsetMs       int    `json:"endOffsetMs,omitempty"`
-}
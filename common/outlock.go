@@ -0,0 +1,192 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
+)
+
+const (
+	lockFileName  = ".ainvil.lock"
+	lockRetryWait = 200 * time.Millisecond
+)
+
+// errLocked is returned by tryLockFile when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// OutLock is an exclusive lock on an output tree, held on a lock file in its
+// root, so two ainvil processes never write the same archive at once. The
+// operating system releases it when the holder exits, however it exits, so
+// a crashed run never leaves the tree locked.
+type OutLock struct {
+	f *os.File
+}
+
+// LockOutDir takes the lock on outRoot, waiting up to wait for another
+// process to release it. Once locked, temp files orphaned by an interrupted
+// run are removed from the folders the manifest knows. "ainvil reindex"
+// sweeps the whole tree.
+func LockOutDir(outRoot string, wait time.Duration) (*OutLock, error) {
+	lock, err := lockOutDir(outRoot, wait)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := cleanTempFiles(knownDirs(outRoot)); n > 0 {
+		fmt.Printf("Removed %d temp file(s) left by an interrupted run\n", n)
+	}
+	return lock, nil
+}
+
+// lockOutDir takes the lock without the temp file sweep, for callers that
+// lock many times over their lifetime.
+func lockOutDir(outRoot string, wait time.Duration) (*OutLock, error) {
+	if err := os.MkdirAll(outRoot, 0755); err != nil {
+		return nil, fmt.Errorf("creating output dir: %w", err)
+	}
+	path := filepath.Join(outRoot, lockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err := tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLocked) {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%s is locked by another ainvil process%s", outRoot, lockHolder(path))
+		}
+		time.Sleep(lockRetryWait)
+	}
+
+	// Note who holds the lock, for the message other processes print.
+	host, _ := os.Hostname()
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "%d\n%s\n%s\n", os.Getpid(), host, time.Now().UTC().Format(time.RFC3339))
+	}
+	return &OutLock{f: f}, nil
+}
+
+// Unlock releases the lock. It is safe to call more than once. The lock file
+// stays in place: removing it would let a process that already opened it
+// lock a file no one else sees.
+func (l *OutLock) Unlock() {
+	if l == nil || l.f == nil {
+		return
+	}
+	unlockFile(l.f)
+	l.f.Close()
+	l.f = nil
+}
+
+// lockHolder describes the process recorded in the lock file at path, or
+// returns "" if it cannot be read.
+func lockHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 3 || lines[0] == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (pid %s on %s since %s)", lines[0], lines[1], lines[2])
+}
+
+// knownDirs returns the folders an interrupted write can have left temp
+// files in without a full walk: the output root, its state folder, the
+// undated folder and every folder the manifest has an export in.
+func knownDirs(outRoot string) []string {
+	seen := map[string]bool{}
+	dirs := []string{outRoot, filepath.Join(outRoot, stateDir), filepath.Join(outRoot, undatedDir)}
+	if m, err := loadManifest(outRoot); err == nil {
+		for key := range m.Entries {
+			dirs = append(dirs, filepath.Dir(filepath.Join(outRoot, filepath.FromSlash(key))))
+		}
+	}
+
+	var unique []string
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
+
+// cleanTempFiles removes temp files written by writeFileAtomic that were
+// never renamed into place from dirs, without descending into subfolders.
+func cleanTempFiles(dirs []string) int {
+	removed := 0
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && ainvil.IsTempFile(e.Name()) {
+				if err := os.Remove(filepath.Join(dir, e.Name())); err == nil {
+					removed++
+				}
+			}
+		}
+	}
+	return removed
+}
+
+// cleanAllTempFiles is cleanTempFiles for every folder below outRoot.
+func cleanAllTempFiles(outRoot string) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(outRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && ainvil.IsTempFile(d.Name()) {
+			if err := os.Remove(path); err == nil {
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// writeFileAtomic writes data to a temp file next to path, fsyncs it and
+// renames it over path, so readers only ever see the old or the new file.
+var writeFileAtomic = ainvil.WriteFileAtomic
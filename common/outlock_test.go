@@ -0,0 +1,97 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLockOutDirExclusive(t *testing.T) {
+	silenceStdout(t)
+	outDir := t.TempDir()
+
+	lock, err := LockOutDir(outDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LockOutDir(outDir, lockRetryWait)
+	if err == nil || !strings.Contains(err.Error(), "locked by another ainvil process") {
+		t.Fatalf("second lock: got %v, want locked", err)
+	}
+
+	lock.Unlock()
+	lock.Unlock()
+	again, err := LockOutDir(outDir, 0)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	again.Unlock()
+}
+
+func TestLockOutDirSweepsKnownDirs(t *testing.T) {
+	silenceStdout(t)
+	outDir := t.TempDir()
+
+	w, err := NewExportWriter(outDir, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Save("api", &PendantExport{ID: "a", SourceType: "bee", StartTime: "2025-06-03T19:15:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	known := filepath.Join(outDir, "2025", "06", "03", ".ainvil-bee_a.json-1.tmp")
+	unknown := filepath.Join(outDir, "2024", "01", "01", ".ainvil-bee_b.json-1.tmp")
+	for _, path := range []string{known, unknown} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lock, err := LockOutDir(outDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+	if _, err := os.Stat(known); !os.IsNotExist(err) {
+		t.Errorf("temp file in a manifest folder survived the lock (%v)", err)
+	}
+	if _, err := os.Stat(unknown); err != nil {
+		t.Errorf("locking walked outside the manifest folders: %v", err)
+	}
+
+	if _, err := Reindex(outDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(unknown); !os.IsNotExist(err) {
+		t.Errorf("reindex left a temp file behind (%v)", err)
+	}
+}
@@ -23,13 +23,26 @@ package common
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
-	"time"
 )
 
+func init() {
+	RegisterParser(Parser{Name: "bee", Sniff: sniffBee, Parse: ParseBeeFile})
+}
+
+// sniffBee matches the "Start Time:" header together with one of the other
+// headers Bee always writes.
+func sniffBee(head []byte) bool {
+	return bytes.Contains(head, []byte("Start Time:")) &&
+		(bytes.Contains(head, []byte("Short Summary:")) ||
+			bytes.Contains(head, []byte("Device Type:")) ||
+			bytes.Contains(head, []byte("Transcription:")))
+}
+
 func ParseBeeFile(path string) (*PendantExport, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -139,23 +152,21 @@ func ParseBeeFile(path string) (*PendantExport, error) {
 		Title:      shortSummary,
 		Overview:   strings.Join(summaryLines, "\n"),
 		Transcript: strings.Join(transcriptionLines, "\n"),
-		Contents: []ContentEntry{
+		Contents: append([]ContentEntry{
 			{Type: "heading1", Content: shortSummary},
 			{Type: "heading2", Content: strings.Join(summaryLines, "\n")},
-			{Type: "paragraph", Content: strings.Join(transcriptionLines, "\n")},
-		},
+		}, splitUtterances(transcriptionLines, startTime)...),
 		Raw: rawBytes,
 	}, nil
 }
 
 func parseBeeTimestamp(raw string) string {
-	layout := "Jan 2, 2006 at 3:04 PM"
-	t, err := time.Parse(layout, raw)
+	t, err := NormalizeTime("bee", raw, "Jan 2, 2006 at 3:04 PM", "January 2, 2006 at 3:04 PM")
 	if err != nil {
 		fmt.Printf("Warning: couldn't parse Bee time %q: %v\n", raw, err)
 		return raw // preserve original unparsed
 	}
-	return t.Format(time.RFC3339)
+	return t
 }
 
 func parseHeaderValue(scanner *bufio.Scanner, line, prefix string) string {
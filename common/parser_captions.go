@@ -0,0 +1,327 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// cueTimingRE matches a WebVTT or SRT timing line. Hours are optional in
+	// WebVTT, and SRT separates milliseconds with a comma.
+	cueTimingRE = regexp.MustCompile(`^((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})\s+-->\s+((?:\d+:)?\d{1,2}:\d{2}[.,]\d{1,3})`)
+	srtSniffRE  = regexp.MustCompile(`(?m)\A\s*\d+\s*\r?\n\d{1,2}:\d{2}:\d{2},\d{3}\s+-->`)
+	voiceRE     = regexp.MustCompile(`<v(?:\.[^\s>]*)?\s+([^>]+)>`)
+	cueTagRE    = regexp.MustCompile(`</?[^>]*>`)
+	// speakerPrefixRE matches the "Name: text" form Zoom and many SRT tools
+	// use instead of voice tags: up to three capitalized words and a colon.
+	speakerPrefixRE = regexp.MustCompile(`^([A-Z][\w.'-]*(?: [A-Z][\w.'-]*){0,2}):\s+(.+)$`)
+)
+
+// captionTimeLayouts are accepted for sidecar and --start-time values
+// without an offset, in the source's zone.
+var captionTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04"}
+
+// captionStartKey is the metadata key recording where a caption export's
+// start time came from: "flag", "sidecar" or "mtime".
+const captionStartKey = "startTimeSource"
+
+func init() {
+	RegisterParser(Parser{Name: "vtt", Extensions: []string{".vtt"}, Sniff: sniffVTT, Parse: ParseVTTFile})
+	RegisterParser(Parser{Name: "srt", Extensions: []string{".srt"}, Sniff: sniffSRT, Parse: ParseSRTFile})
+}
+
+// sniffVTT matches the WEBVTT signature every WebVTT file starts with.
+func sniffVTT(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(head, []byte("WEBVTT"))
+}
+
+// sniffSRT matches a cue number followed by an SRT timing line.
+func sniffSRT(head []byte) bool {
+	return srtSniffRE.Match(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+}
+
+// CaptionSidecar is the optional JSON file next to a caption file, named
+// after it with ".json" added or in place of the extension
+// (meeting.vtt.json or meeting.json).
+type CaptionSidecar struct {
+	// StartTime is when the recording began, RFC3339 or "YYYY-MM-DD
+	// HH:MM:SS" in the source's zone.
+	StartTime  string `json:"startTime"`
+	Title      string `json:"title"`
+	DeviceType string `json:"deviceType"`
+}
+
+// ProcessCaptions imports the .vtt or .srt files below sourceDir. format is
+// "vtt" or "srt". A non-zero start is used as the start time of every file;
+// otherwise it comes from a sidecar or the file's modification time.
+func ProcessCaptions(ctx context.Context, sourceDir, outDir, format string, start time.Time, opts ImportOptions) error {
+	p := Parser{Name: format, Parse: CaptionParser(format, start)}
+	return importSources(ctx, sourceDir, outDir, opts, []string{"*." + format}, func(string) (Parser, error) {
+		return p, nil
+	})
+}
+
+// CaptionParser returns a ParserFunc for format ("vtt" or "srt") that uses
+// start, when set, as the absolute start time of each file.
+func CaptionParser(format string, start time.Time) ParserFunc {
+	return func(path string) (*PendantExport, error) {
+		return parseCaptionFile(path, format, start)
+	}
+}
+
+// ParseVTTFile parses a WebVTT file, taking its start time from a sidecar
+// or the file's modification time.
+func ParseVTTFile(path string) (*PendantExport, error) {
+	return parseCaptionFile(path, "vtt", time.Time{})
+}
+
+// ParseSRTFile parses an SRT file, taking its start time from a sidecar or
+// the file's modification time.
+func ParseSRTFile(path string) (*PendantExport, error) {
+	return parseCaptionFile(path, "srt", time.Time{})
+}
+
+// ParseCaptionStart parses a --start-time value for format.
+func ParseCaptionStart(format, raw string) (time.Time, error) {
+	return ParseSourceTime(format, raw, captionTimeLayouts...)
+}
+
+func parseCaptionFile(path, format string, start time.Time) (*PendantExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %v", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == "vtt" && !sniffVTT(data) {
+		return nil, fmt.Errorf("missing WEBVTT header")
+	}
+
+	cues, err := parseCues(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("no cues found")
+	}
+
+	sidecar, err := readCaptionSidecar(path)
+	if err != nil {
+		return nil, err
+	}
+	startSource := "flag"
+	if start.IsZero() && sidecar.StartTime != "" {
+		if start, err = ParseCaptionStart(format, sidecar.StartTime); err != nil {
+			return nil, fmt.Errorf("sidecar startTime: %w", err)
+		}
+		startSource = "sidecar"
+	}
+	if start.IsZero() {
+		// The start time is part of the content ID, so a copied or touched
+		// file imports again as a new entry. Say so.
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		start = info.ModTime()
+		startSource = "mtime"
+		fmt.Printf("Warning: %s has no start time, using its modification time; set --start-time or add a sidecar\n", filepath.Base(path))
+	}
+	start = start.In(SourceLocation(format))
+
+	contents := make([]ContentEntry, 0, len(cues))
+	var last time.Duration
+	for _, c := range cues {
+		contents = append(contents, ContentEntry{
+			Type:          "blockquote",
+			Content:       c.text,
+			SpeakerName:   c.speaker,
+			StartOffsetMs: int(c.start.Milliseconds()),
+			EndOffsetMs:   int(c.end.Milliseconds()),
+			StartTime:     start.Add(c.start).Format(time.RFC3339),
+			EndTime:       start.Add(c.end).Format(time.RFC3339),
+		})
+		last = max(last, c.end)
+	}
+
+	title := sidecar.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	rawData, err := json.Marshal(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("marshalling raw text: %v", err)
+	}
+
+	return &PendantExport{
+		StartTime:  start.Format(time.RFC3339),
+		EndTime:    start.Add(last).Format(time.RFC3339),
+		Title:      title,
+		Transcript: blockquoteTranscript(contents),
+		Contents:   contents,
+		DeviceType: sidecar.DeviceType,
+		Metadata:   map[string]string{captionStartKey: startSource},
+		Raw:        rawData,
+	}, nil
+}
+
+// readCaptionSidecar loads the sidecar of the caption file at path, if
+// there is one.
+func readCaptionSidecar(path string) (CaptionSidecar, error) {
+	var sidecar CaptionSidecar
+	for _, name := range []string{path + ".json", strings.TrimSuffix(path, filepath.Ext(path)) + ".json"} {
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return sidecar, err
+		}
+		if err := json.Unmarshal(data, &sidecar); err != nil {
+			return sidecar, fmt.Errorf("reading sidecar %s: %w", filepath.Base(name), err)
+		}
+		return sidecar, nil
+	}
+	return sidecar, nil
+}
+
+type cue struct {
+	start, end time.Duration
+	speaker    string
+	text       string
+}
+
+// parseCues reads the cues of a WebVTT or SRT file. Both are blank-line
+// separated blocks; a block is a cue if it has a timing line, which may be
+// preceded by an identifier (the cue number in SRT). NOTE, STYLE and REGION
+// blocks and the WEBVTT header have none and are skipped.
+func parseCues(data []byte) ([]cue, error) {
+	var cues []cue
+	var block []string
+
+	flush := func() error {
+		defer func() { block = block[:0] }()
+		for i, line := range block {
+			m := cueTimingRE.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			start, err := parseCueTime(m[1])
+			if err != nil {
+				return err
+			}
+			end, err := parseCueTime(m[2])
+			if err != nil {
+				return err
+			}
+			speaker, text := cuePayload(block[i+1:])
+			if text != "" {
+				cues = append(cues, cue{start: start, end: end, speaker: speaker, text: text})
+			}
+			return nil
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return cues, nil
+}
+
+// cuePayload returns the speaker and plain text of a cue's payload lines.
+// The speaker comes from the first <v Speaker> voice tag or, failing that, a
+// leading "Name:". Other markup is stripped and entities decoded.
+func cuePayload(lines []string) (speaker, text string) {
+	payload := strings.Join(lines, "\n")
+	if m := voiceRE.FindStringSubmatch(payload); m != nil {
+		speaker = strings.TrimSpace(m[1])
+	}
+
+	parts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(html.UnescapeString(cueTagRE.ReplaceAllString(line, "")))
+		if line != "" {
+			parts = append(parts, line)
+		}
+	}
+	text = strings.Join(parts, " ")
+
+	if speaker == "" {
+		if m := speakerPrefixRE.FindStringSubmatch(text); m != nil {
+			speaker, text = m[1], m[2]
+		}
+	}
+	return speaker, text
+}
+
+// parseCueTime parses "hh:mm:ss.ttt", "mm:ss.ttt" or SRT's "hh:mm:ss,ttt".
+func parseCueTime(s string) (time.Duration, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	clock, frac, _ := strings.Cut(s, ".")
+	fields := strings.Split(clock, ":")
+
+	var secs int
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return 0, fmt.Errorf("bad cue time %q", s)
+		}
+		secs = secs*60 + n
+	}
+	for len(frac) < 3 {
+		frac += "0"
+	}
+	ms, err := strconv.Atoi(frac)
+	if err != nil {
+		return 0, fmt.Errorf("bad cue time %q", s)
+	}
+	return time.Duration(secs)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
@@ -0,0 +1,238 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// copyCaption copies the caption fixture name into a fresh directory,
+// without its sidecar, and returns the copy's path.
+func copyCaption(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "captions", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseCueTime(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"00:01.500", 1500 * time.Millisecond},
+		{"01:02.5", time.Minute + 2500*time.Millisecond},
+		{"00:00:04.000", 4 * time.Second},
+		{"01:00:02.250", time.Hour + 2250*time.Millisecond},
+		{"00:00:03,500", 3500 * time.Millisecond},
+		{"100:00:00.000", 100 * time.Hour},
+	} {
+		got, err := parseCueTime(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseCueTime(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+	if _, err := parseCueTime("00:xx.000"); err == nil {
+		t.Error("expected an error for a malformed time")
+	}
+}
+
+func TestCuePayload(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		lines         []string
+		speaker, text string
+	}{
+		{"voice tag", []string{"<v Alice Smith>Hello <i>there</i>.</v>"}, "Alice Smith", "Hello there."},
+		{"voice tag with class", []string{"<v.loud Bob>Hi &amp; bye."}, "Bob", "Hi & bye."},
+		{"multi-line", []string{"<v Bob>First line", "second line."}, "Bob", "First line second line."},
+		{"name prefix", []string{"Carol Jones: Wrapping up."}, "Carol Jones", "Wrapping up."},
+		{"voice tag wins over prefix", []string{"<v Dan>Note: this stays."}, "Dan", "Note: this stays."},
+		{"lowercase is not a speaker", []string{"note: not a name"}, "", "note: not a name"},
+		{"too many words", []string{"One Two Three Four: text"}, "", "One Two Three Four: text"},
+		{"no speaker", []string{"just text"}, "", "just text"},
+	} {
+		speaker, text := cuePayload(tc.lines)
+		if speaker != tc.speaker || text != tc.text {
+			t.Errorf("%s: got %q, %q, want %q, %q", tc.name, speaker, text, tc.speaker, tc.text)
+		}
+	}
+}
+
+func TestCaptionSniffing(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		head     string
+		vtt, srt bool
+	}{
+		{"webvtt", "WEBVTT\n\n00:01.000 --> 00:02.000\nHi\n", true, false},
+		{"webvtt with BOM", "\xef\xbb\xbfWEBVTT - title\n", true, false},
+		{"srt", "1\n00:00:01,000 --> 00:00:02,000\nHi\n", false, true},
+		{"srt with BOM and CRLF", "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\n", false, true},
+		{"srt with leading blank lines", "\n\n12\n00:00:01,000 --> 00:00:02,000\n", false, true},
+		{"dot separated srt", "1\n00:00:01.000 --> 00:00:02.000\n", false, false},
+		{"plain text", "Speaker 1: hello\n", false, false},
+	} {
+		if got := sniffVTT([]byte(tc.head)); got != tc.vtt {
+			t.Errorf("%s: sniffVTT = %v", tc.name, got)
+		}
+		if got := sniffSRT([]byte(tc.head)); got != tc.srt {
+			t.Errorf("%s: sniffSRT = %v", tc.name, got)
+		}
+	}
+}
+
+func TestParseVTTFileWithSidecar(t *testing.T) {
+	pinTimezones(t, "America/Los_Angeles")
+	export, err := ParseVTTFile(filepath.Join("testdata", "captions", "standup.vtt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.Title != "Weekly standup" || export.DeviceType != "zoom" {
+		t.Fatalf("got title %q, device %q", export.Title, export.DeviceType)
+	}
+	if export.Metadata[captionStartKey] != "sidecar" {
+		t.Fatalf("got metadata %v", export.Metadata)
+	}
+	if export.StartTime != "2025-08-01T09:30:00-07:00" || export.EndTime != "2025-08-01T10:30:02-07:00" {
+		t.Fatalf("got %s - %s", export.StartTime, export.EndTime)
+	}
+
+	want := []struct {
+		speaker, text  string
+		startMs, endMs int
+		start          string
+	}{
+		{"Alice Smith", "Good morning, everyone.", 1500, 4000, "2025-08-01T09:30:01-07:00"},
+		{"Bob", "Morning & welcome. Let's start.", 4000, 9250, "2025-08-01T09:30:04-07:00"},
+		{"Carol Jones", "Wrapping up.", 3600000, 3602500, "2025-08-01T10:30:00-07:00"},
+	}
+	if len(export.Contents) != len(want) {
+		t.Fatalf("got %d cues, want %d: %+v", len(export.Contents), len(want), export.Contents)
+	}
+	for i, w := range want {
+		c := export.Contents[i]
+		if c.Type != "blockquote" || c.SpeakerName != w.speaker || c.Content != w.text ||
+			c.StartOffsetMs != w.startMs || c.EndOffsetMs != w.endMs || c.StartTime != w.start {
+			t.Errorf("cue %d = %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+func TestParseSRTFile(t *testing.T) {
+	pinTimezones(t, "UTC")
+	start := time.Date(2025, 8, 1, 14, 0, 0, 0, time.UTC)
+	export, err := CaptionParser("srt", start)(filepath.Join("testdata", "captions", "call.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.Title != "call" || export.Metadata[captionStartKey] != "flag" {
+		t.Fatalf("got title %q, metadata %v", export.Title, export.Metadata)
+	}
+	if export.StartTime != "2025-08-01T14:00:00Z" || export.EndTime != "2025-08-01T14:00:06Z" {
+		t.Fatalf("got %s - %s", export.StartTime, export.EndTime)
+	}
+	if len(export.Contents) != 2 {
+		t.Fatalf("got %d cues: %+v", len(export.Contents), export.Contents)
+	}
+	if c := export.Contents[0]; c.SpeakerName != "Alice Smith" || c.Content != "Hello." || c.StartOffsetMs != 1000 || c.EndOffsetMs != 3500 {
+		t.Errorf("cue 0 = %+v", c)
+	}
+	if c := export.Contents[1]; c.SpeakerName != "" || c.Content != "this line has no speaker" {
+		t.Errorf("cue 1 = %+v", c)
+	}
+}
+
+func TestCaptionStartPrecedence(t *testing.T) {
+	pinTimezones(t, "UTC")
+	silenceStdout(t)
+	path := copyCaption(t, "standup.vtt")
+	mtime := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, start time.Time, wantStart, wantSource string) {
+		t.Helper()
+		export, err := CaptionParser("vtt", start)(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if export.StartTime != wantStart || export.Metadata[captionStartKey] != wantSource {
+			t.Errorf("%s: got %s from %q, want %s from %q", name, export.StartTime, export.Metadata[captionStartKey], wantStart, wantSource)
+		}
+	}
+
+	check("no sidecar", time.Time{}, "2024-03-04T05:06:07Z", "mtime")
+
+	sidecar := `{"startTime": "2025-08-01T09:30:00Z"}`
+	if err := os.WriteFile(path+".json", []byte(sidecar), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check("sidecar", time.Time{}, "2025-08-01T09:30:00Z", "sidecar")
+	check("flag", time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC), "2025-09-01T08:00:00Z", "flag")
+}
+
+func TestReadCaptionSidecar(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "meeting.vtt")
+
+	sidecar, err := readCaptionSidecar(path)
+	if err != nil || sidecar != (CaptionSidecar{}) {
+		t.Fatalf("no sidecar: got %+v, %v", sidecar, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "meeting.json"), []byte(`{"title": "Short name"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar, err = readCaptionSidecar(path); err != nil || sidecar.Title != "Short name" {
+		t.Fatalf("meeting.json: got %+v, %v", sidecar, err)
+	}
+
+	// meeting.vtt.json is preferred over meeting.json.
+	full := `{"startTime": "2025-08-01 09:30:00", "title": "Full name", "deviceType": "teams"}`
+	if err := os.WriteFile(path+".json", []byte(full), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := CaptionSidecar{StartTime: "2025-08-01 09:30:00", Title: "Full name", DeviceType: "teams"}
+	if sidecar, err = readCaptionSidecar(path); err != nil || sidecar != want {
+		t.Fatalf("meeting.vtt.json: got %+v, %v", sidecar, err)
+	}
+
+	if err := os.WriteFile(path+".json", []byte(`{"title": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCaptionSidecar(path); err == nil {
+		t.Fatal("expected an error for a malformed sidecar")
+	}
+}
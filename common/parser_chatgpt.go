@@ -23,11 +23,13 @@ package common
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,89 +37,151 @@ import (
 var metaRE = regexp.MustCompile(`^(Recorder|Timezone|Start|End):\s*(.+)$`)
 var lineRE = regexp.MustCompile(`^\[(\d+)\]\s+(Speaker \d+):\s*(.+)$`)
 
-func ParseChatGPTTranscripts(sourceDir, outDir string) error {
-	return filepath.WalkDir(sourceDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".txt") {
-			return nil
-		}
-		fmt.Println("Parsing:", path)
-		return parseFile(path, outDir)
+func init() {
+	RegisterParser(Parser{Name: "chatgpt", Sniff: sniffChatGPT, Parse: ParseChatGPTFile})
+}
+
+// sniffChatGPT matches the Recorder/Timezone/Start/End header block or a
+// bracketed "[offset] Speaker N:" transcript line.
+func sniffChatGPT(head []byte) bool {
+	return sniffLines(head, func(line string) bool {
+		return metaRE.MatchString(line) || lineRE.MatchString(line)
+	})
+}
+
+// ParseChatGPTTranscripts imports every .txt file below sourceDir through the
+// shared processor.
+func ParseChatGPTTranscripts(ctx context.Context, sourceDir, outDir string, opts ImportOptions) error {
+	p := Parser{Name: "chatgpt", Parse: ParseChatGPTFile}
+	return importSources(ctx, sourceDir, outDir, opts, []string{"*.txt"}, func(string) (Parser, error) {
+		return p, nil
 	})
 }
 
-func parseFile(filePath, outDir string) error {
-	f, err := os.Open(filePath)
+// chatgptTimeLayout is the layout of the Start/End headers. They are wall
+// clock times in the zone named by the Timezone header.
+const chatgptTimeLayout = "2006-01-02 15:04:05.000"
+
+// ParseChatGPTFile parses a ChatGPT meeting transcript. The bracketed number
+// in front of each line is the utterance's offset in seconds from Start; an
+// utterance ends where the next one begins, the last one at End.
+func ParseChatGPTFile(filePath string) (*PendantExport, error) {
+	rawFileBytes, err := os.ReadFile(filePath)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("reading file: %v", err)
 	}
-	defer f.Close()
 
 	var (
-		start, end time.Time
-		lines      []ContentEntry
-		transcript strings.Builder
+		recorder, timezone string
+		startRaw, endRaw   string
+		offsets            []int
+		lines              []ContentEntry
+		transcript         strings.Builder
 	)
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(bytes.NewReader(rawFileBytes))
 	for scanner.Scan() {
 		line := scanner.Text()
 
 		if matches := metaRE.FindStringSubmatch(line); len(matches) == 3 {
+			value := strings.TrimSpace(matches[2])
 			switch matches[1] {
+			case "Recorder":
+				recorder = value
+			case "Timezone":
+				timezone = value
 			case "Start":
-				start, _ = time.Parse("2006-01-02 15:04:05.000", matches[2])
+				startRaw = value
 			case "End":
-				end, _ = time.Parse("2006-01-02 15:04:05.000", matches[2])
+				endRaw = value
 			}
 		} else if matches := lineRE.FindStringSubmatch(line); len(matches) == 4 {
 			offset := matches[1]
 			speaker := matches[2]
 			text := matches[3]
 
+			secs, _ := strconv.Atoi(offset)
+			offsets = append(offsets, secs)
 			lines = append(lines, ContentEntry{
-				Type:        "blockquote",
-				Content:     text,
-				SpeakerName: speaker,
-				StartTime:   offset,
+				Type:          "blockquote",
+				Content:       text,
+				SpeakerName:   speaker,
+				StartOffsetMs: secs * 1000,
 			})
 			transcript.WriteString(fmt.Sprintf("[%s] %s: %s\n", offset, speaker, text))
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	rawData, _ := json.Marshal(map[string]any{
-		"sourceFile": filepath.Base(filePath),
-		"exportedAt": time.Now().Format(time.RFC3339),
-	})
+	loc, err := loadTimezone(timezone)
+	if err != nil {
+		loc = SourceLocation("chatgpt")
+		fmt.Printf("Warning: unknown timezone %q in %s, using %s\n", timezone, filePath, loc)
+	}
+	start, startErr := time.ParseInLocation(chatgptTimeLayout, startRaw, loc)
+	end, endErr := time.ParseInLocation(chatgptTimeLayout, endRaw, loc)
 
-	export := PendantExport{
-		ID:            GenerateID(),
-		SourceType:    "chatgpt",
-		StartTime:     start.Format(time.RFC3339),
-		EndTime:       end.Format(time.RFC3339),
-		Transcript:    transcript.String(),
-		ExportDate:    time.Now().Format("2006-01-02"),
-		ExportVersion: "1.0",
-		SourceFile:    filepath.Base(filePath),
-		Contents:      lines,
-		Raw:           rawData,
+	startTime, endTime := startRaw, endRaw // preserve original if unparsed
+	if startErr == nil {
+		startTime = start.Format(time.RFC3339)
+	}
+	if endErr == nil {
+		endTime = end.Format(time.RFC3339)
 	}
 
-	folder := filepath.Join(outDir, fmt.Sprintf("%04d", start.Year()), fmt.Sprintf("%02d", start.Month()), fmt.Sprintf("%02d", start.Day()))
-	if err := os.MkdirAll(folder, 0755); err != nil {
-		return err
+	for i := range lines {
+		endOffset := -1
+		if i+1 < len(offsets) {
+			endOffset = offsets[i+1]
+		} else if startErr == nil && endErr == nil {
+			endOffset = int(end.Sub(start).Seconds())
+		}
+		if endOffset >= offsets[i] {
+			lines[i].EndOffsetMs = endOffset * 1000
+		}
+
+		if startErr == nil {
+			lines[i].StartTime = start.Add(time.Duration(offsets[i]) * time.Second).Format(time.RFC3339)
+			if endOffset >= offsets[i] {
+				lines[i].EndTime = start.Add(time.Duration(endOffset) * time.Second).Format(time.RFC3339)
+			}
+		}
 	}
 
-	outputFile := filepath.Join(folder, "chatgpt_"+export.ID+".json")
-	fo, err := os.Create(outputFile)
+	rawData, err := json.Marshal(string(rawFileBytes))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("marshalling raw text: %v", err)
 	}
-	defer fo.Close()
 
-	encoder := json.NewEncoder(fo)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(export)
+	return &PendantExport{
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Transcript: transcript.String(),
+		Contents:   lines,
+		DeviceType: recorder,
+		Raw:        rawData,
+	}, nil
+}
+
+// loadTimezone resolves the Timezone header, which is either an IANA name or
+// a fixed offset such as "UTC-07:00" / "+0530". Files without the header use
+// the zone configured for the chatgpt source.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return SourceLocation("chatgpt"), nil
+	}
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc, nil
+	}
+
+	offset := strings.TrimPrefix(strings.TrimPrefix(name, "UTC"), "GMT")
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		if t, err := time.Parse(layout, offset); err == nil {
+			_, secs := t.Zone()
+			return time.FixedZone(name, secs), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown timezone %q", name)
 }
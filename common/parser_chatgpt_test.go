@@ -0,0 +1,189 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// pinTimezones configures the default zone and per-source overrides for
+// the rest of the test, restoring the previous settings afterwards.
+func pinTimezones(t *testing.T, def string, overrides ...string) {
+	t.Helper()
+	prevDefault := defaultLocation
+	prevSources := sourceLocations
+	sourceLocations = map[string]*time.Location{}
+	t.Cleanup(func() {
+		defaultLocation = prevDefault
+		sourceLocations = prevSources
+	})
+	if err := ConfigureTimezones(def, overrides); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeChatGPTFixture(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chat.txt")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseChatGPTFileOffsets(t *testing.T) {
+	silenceStdout(t)
+	export, err := ParseChatGPTFile(filepath.Join("testdata", "mixed", "chatgpt.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.StartTime != "2025-06-05T10:00:00-07:00" || export.EndTime != "2025-06-05T10:05:00-07:00" {
+		t.Fatalf("got %s - %s", export.StartTime, export.EndTime)
+	}
+	want := []struct {
+		speaker          string
+		startMs, endMs   int
+		start, end, text string
+	}{
+		{"Speaker 1", 0, 12000, "2025-06-05T10:00:00-07:00", "2025-06-05T10:00:12-07:00", "Hello there."},
+		{"Speaker 2", 12000, 30000, "2025-06-05T10:00:12-07:00", "2025-06-05T10:00:30-07:00", "Hi."},
+		{"Speaker 1", 30000, 300000, "2025-06-05T10:00:30-07:00", "2025-06-05T10:05:00-07:00", "Let's begin."},
+	}
+	if len(export.Contents) != len(want) {
+		t.Fatalf("got %d contents, want %d", len(export.Contents), len(want))
+	}
+	for i, w := range want {
+		c := export.Contents[i]
+		if c.Type != "blockquote" || c.SpeakerName != w.speaker || c.Content != w.text ||
+			c.StartOffsetMs != w.startMs || c.EndOffsetMs != w.endMs ||
+			c.StartTime != w.start || c.EndTime != w.end {
+			t.Errorf("line %d: got %+v", i, c)
+		}
+	}
+	if export.DeviceType != "ChatGPT" {
+		t.Errorf("device type %q", export.DeviceType)
+	}
+}
+
+func TestParseChatGPTFileTimezones(t *testing.T) {
+	silenceStdout(t)
+	pinTimezones(t, "UTC", "chatgpt=Asia/Tokyo")
+
+	tests := []struct {
+		name      string
+		header    string
+		wantStart string
+	}{
+		{"IANA zone", "Timezone: Europe/Berlin\n", "2025-06-05T10:00:00+02:00"},
+		{"UTC offset", "Timezone: UTC-07:00\n", "2025-06-05T10:00:00-07:00"},
+		{"GMT offset", "Timezone: GMT+0530\n", "2025-06-05T10:00:00+05:30"},
+		{"bare offset", "Timezone: -03\n", "2025-06-05T10:00:00-03:00"},
+		{"no header uses source zone", "", "2025-06-05T10:00:00+09:00"},
+		{"unknown zone falls back", "Timezone: Mars/Olympus\n", "2025-06-05T10:00:00+09:00"},
+	}
+	for _, tt := range tests {
+		path := writeChatGPTFixture(t, "Recorder: ChatGPT\n"+tt.header+
+			"Start: 2025-06-05 10:00:00.000\nEnd: 2025-06-05 10:01:00.000\n\n[0] Speaker 1: Hi.\n")
+		export, err := ParseChatGPTFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if export.StartTime != tt.wantStart {
+			t.Errorf("%s: start %s, want %s", tt.name, export.StartTime, tt.wantStart)
+		}
+	}
+}
+
+func TestParseChatGPTFileUnparsedStart(t *testing.T) {
+	silenceStdout(t)
+	path := writeChatGPTFixture(t, "Start: yesterday\nEnd: today\n\n[0] Speaker 1: Hi.\n[5] Speaker 2: Hello.\n")
+	export, err := ParseChatGPTFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.StartTime != "yesterday" || export.EndTime != "today" {
+		t.Fatalf("raw times not preserved: %s - %s", export.StartTime, export.EndTime)
+	}
+	first, last := export.Contents[0], export.Contents[1]
+	if first.EndOffsetMs != 5000 || first.StartTime != "" {
+		t.Errorf("first line: %+v", first)
+	}
+	if last.EndOffsetMs != 0 || last.EndTime != "" {
+		t.Errorf("last line has an end without a known end time: %+v", last)
+	}
+}
+
+func TestImportChatGPTExport(t *testing.T) {
+	silenceStdout(t)
+	pinTimezones(t, "America/Los_Angeles")
+	data, err := os.ReadFile(filepath.Join("testdata", "mixed", "chatgpt.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, out := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "chat.txt"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ImportOptions{PlanOutput: filepath.Join(t.TempDir(), "plan.json")}
+	if err := ImportMixedExports(context.Background(), src, out, opts); err != nil {
+		t.Fatal(err)
+	}
+	plan := readPlan(t, opts.PlanOutput)
+	if len(plan.Entries) != 1 {
+		t.Fatalf("got %d plan entries, want 1", len(plan.Entries))
+	}
+	entry := plan.Entries[0]
+	if entry.Action != ActionCreate || entry.SourceType != "chatgpt" {
+		t.Fatalf("got %s of a %q export", entry.Action, entry.SourceType)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{24}$`).MatchString(entry.ID) {
+		t.Errorf("got ID %q, want a content hash", entry.ID)
+	}
+	want := filepath.Join(out, "2025", "06", "05", "chatgpt_"+entry.ID+".json")
+	if entry.Target != want {
+		t.Errorf("saved to %s, want %s", entry.Target, want)
+	}
+
+	saved, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export PendantExport
+	if err := json.Unmarshal(saved, &export); err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(filepath.Join(src, "chat.txt"))
+	if export.SourceType != "chatgpt" || export.ID != entry.ID || export.SourceFile != abs || export.StartTime != "2025-06-05T10:00:00-07:00" {
+		t.Errorf("got %s %s from %s at %s", export.SourceType, export.ID, export.SourceFile, export.StartTime)
+	}
+	if export.ID != ContentID(&export) {
+		t.Errorf("ID %s does not match the content", export.ID)
+	}
+}
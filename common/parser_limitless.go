@@ -22,13 +22,11 @@ THE SOFTWARE.
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -38,165 +36,349 @@ func toJSON(v any) []byte {
 	return b
 }
 
-func ParseLimitlessData(apiKey, apiURL, start, outputDir string) error {
+// LimitlessOptions are the Limitless specific settings of a sync.
+type LimitlessOptions struct {
+	// Lookback widens an incremental sync: instead of starting at the
+	// newest lifelog already synced, it starts this much earlier, and
+	// lifelogs in the window whose updatedAt moved on since the local copy
+	// are rewritten with the previous version kept in history.
+	Lookback time.Duration
+	// Resume continues an interrupted sync from its checkpoint.
+	Resume bool
+	// Timeout limits each HTTP request. 0 means 30 seconds.
+	Timeout time.Duration
+	// Retries and RetryDelay configure the client's backoff; see
+	// LimitlessClient. Zero values keep the defaults.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Date fetches the lifelogs that began on this day (YYYY-MM-DD).
+	Date string
+	// End is the end of the range, as a date, "YYYY-MM-DD HH:MM:SS" or
+	// RFC3339.
+	End string
+	// Direction is the sort order, "asc" or "desc". Empty leaves the API's
+	// default (desc).
+	Direction string
+	// StarredOnly fetches starred lifelogs only.
+	StarredOnly bool
+	// OmitMarkdown and OmitHeadings leave the markdown rendering and the
+	// heading nodes out of the response.
+	OmitMarkdown bool
+	OmitHeadings bool
+}
+
+// limitlessTimeLayout is the "modified ISO-8601" the API takes for start
+// and end. It ignores offsets and reads the time in the timezone parameter.
+const limitlessTimeLayout = "2006-01-02 15:04:05"
+
+// query returns the lifelogs query parameters for lopts, apart from start
+// and cursor.
+func (lopts LimitlessOptions) query() (url.Values, error) {
+	params := url.Values{"limit": {"100"}}
+
+	// The zone set with --tz or --source-tz limitless=Zone decides which
+	// day --date means and how start and end are read.
+	if _, name := limitlessZone(); name != "" {
+		params.Set("timezone", name)
+	}
+	if lopts.Date != "" {
+		if _, err := time.Parse("2006-01-02", lopts.Date); err != nil {
+			return nil, fmt.Errorf("invalid --date %q, expected YYYY-MM-DD", lopts.Date)
+		}
+		params.Set("date", lopts.Date)
+	}
+	if lopts.End != "" {
+		params.Set("end", limitlessTime(lopts.End))
+	}
+	switch lopts.Direction {
+	case "":
+	case "asc", "desc":
+		params.Set("direction", lopts.Direction)
+	default:
+		return nil, fmt.Errorf("invalid --direction %q, expected asc or desc", lopts.Direction)
+	}
+	if lopts.StarredOnly {
+		params.Set("isStarred", "true")
+	}
+	if lopts.OmitMarkdown {
+		params.Set("includeMarkdown", "false")
+	}
+	if lopts.OmitHeadings {
+		params.Set("includeHeadings", "false")
+	}
+	return params, nil
+}
+
+// limitlessZone returns the zone start and end are sent in and the name to
+// send as the timezone parameter. The system zone has no name the API
+// understands, so without --tz nothing is sent, and the API reads start and
+// end as UTC.
+func limitlessZone() (*time.Location, string) {
+	loc := SourceLocation("limitless")
+	if loc == time.Local {
+		return time.UTC, ""
+	}
+	return loc, loc.String()
+}
+
+// limitlessTime converts an RFC3339 time into the API's layout, in the
+// zone the API reads it in (see limitlessZone). Anything else is passed on
+// as given.
+func limitlessTime(s string) string {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		loc, _ := limitlessZone()
+		return t.In(loc).Format(limitlessTimeLayout)
+	}
+	return s
+}
+
+// ParseLimitlessData syncs lifelogs from the Limitless API into outputDir.
+// After every page the cursor of the next one is checkpointed in the
+// manifest, so a sync that fails or is interrupted can be continued with
+// lopts.Resume.
+func ParseLimitlessData(ctx context.Context, apiKey, apiURL, start, outputDir string, lopts LimitlessOptions, opts ImportOptions) error {
 	if apiKey == "" || apiURL == "" {
 		return errors.New("missing --token or --url")
 	}
 
-	if start == "" {
-		fmt.Println("No --start provided. Trying to detect most recent saved date in output...")
-		var mostRecent time.Time
-		filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil || info.IsDir() || !strings.HasPrefix(filepath.Base(path), "limitless_") || !strings.HasSuffix(path, ".json") {
-				return nil
-			}
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return nil
-			}
-			var exp PendantExport
-			if err := json.Unmarshal(data, &exp); err == nil && exp.UpdatedAt != "" {
-				if t, err := time.Parse(time.RFC3339, exp.UpdatedAt); err == nil && t.After(mostRecent) {
-					mostRecent = t
-				}
-			}
-			return nil
-		})
-		if !mostRecent.IsZero() {
-			start = mostRecent.Format("2006-01-02")
-			fmt.Println("Using latest discovered date:", start)
-		} else {
-			fmt.Println("No previous files found. Proceeding with no start date filter.")
-		}
+	if lopts.Lookback > 0 {
+		opts.KeepHistory = true
+	}
+
+	client := NewLimitlessClient(apiKey, apiURL, lopts.Timeout)
+	if lopts.Retries > 0 {
+		client.Retries = lopts.Retries
 	}
+	if lopts.RetryDelay > 0 {
+		client.RetryDelay = lopts.RetryDelay
+	}
+
+	w, err := NewExportWriter(outputDir, opts)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
 
 	page := 1
 	cursor := ""
+	params, err := lopts.query()
+	if err != nil {
+		return err
+	}
+	if lopts.Date != "" && (start != "" || lopts.End != "") {
+		return errors.New("--date cannot be combined with --start or --end")
+	}
 
-	for {
-		reqURL := fmt.Sprintf("%s?limit=100", apiURL)
-		if cursor != "" {
-			reqURL += "&cursor=" + cursor
-		} else if start != "" {
-			reqURL += "&start=" + start
+	// checkpointed is set once there is a checkpoint belonging to this sync.
+	cp := w.Checkpoint("limitless")
+	checkpointed := lopts.Resume && cp != nil
+	if checkpointed {
+		if params, err = url.ParseQuery(cp.Query); err != nil {
+			return fmt.Errorf("bad checkpoint: %w", err)
 		}
-		fmt.Printf("Fetching page %d...\n", page)
-		fmt.Println("Request URL:", reqURL)
-
-		req, _ := http.NewRequest("GET", reqURL, nil)
-		req.Header.Set("X-API-Key", apiKey)
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("request error: %w", err)
+		cursor, page = cp.Cursor, cp.Page
+		fmt.Printf("Resuming the sync interrupted at page %d (checkpoint saved %s)\n", page, cp.SavedAt)
+	} else {
+		if lopts.Resume {
+			fmt.Println("No interrupted sync to resume. Starting a new one.")
 		}
-		if resp.StatusCode == 429 {
-			fmt.Println("Rate limit hit. Sleeping 20s then retrying...")
-			time.Sleep(20 * time.Second)
-			resp, err = http.DefaultClient.Do(req)
-			if err != nil || resp.StatusCode == 429 {
-				return fmt.Errorf("still failing after retry: %v", resp.Status)
+		if start == "" && lopts.Date == "" {
+			if mostRecent := w.Cursor("limitless"); !mostRecent.IsZero() {
+				start = mostRecent.Add(-lopts.Lookback).Format("2006-01-02")
+				fmt.Println("No --start provided. Continuing from the last sync:", start)
+				if lopts.Lookback > 0 {
+					fmt.Printf("Looking back %s for edited lifelogs\n", lopts.Lookback)
+				}
+			} else {
+				fmt.Println("No --start provided and nothing synced yet. Proceeding with no start date filter.")
 			}
 		}
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		if resp.StatusCode == 401 || strings.Contains(string(body), "Unauthorized") {
-			return errors.New("unauthorized: check API token")
+		if start != "" {
+			params.Set("start", limitlessTime(start))
 		}
+	}
 
-		var rawResp map[string]interface{}
-		if err := json.Unmarshal(body, &rawResp); err != nil {
-			fmt.Println("JSON error:", err)
+	// The cursor only says where the next page begins; the range
+	// parameters still have to be sent with it.
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	client.OnPage = func(count int, next string) error {
+		switch {
+		case count == 0:
+			fmt.Println("No lifelogs found.")
+			return nil
+		case next == "":
+			fmt.Printf("Saved %d lifelogs from page %d. No nextCursor. Ending pagination.\n", count, page)
+			return nil
+		}
+		fmt.Printf("Saved %d lifelogs from page %d\n", count, page)
+		page++
+		if err := w.SetCheckpoint("limitless", &SyncCheckpoint{
+			Query:  params.Encode(),
+			Cursor: next,
+			Page:   page,
+		}); err != nil {
 			return err
 		}
+		checkpointed = true
+		fmt.Printf("Fetching page %d...\n", page)
+		return nil
+	}
 
-		dataList := []json.RawMessage{}
-		if dataNode, ok := rawResp["data"].(map[string]interface{}); ok {
-			if lifelogs, ok := dataNode["lifelogs"].([]interface{}); ok {
-				for _, item := range lifelogs {
-					if m, err := json.Marshal(item); err == nil {
-						dataList = append(dataList, m)
-					}
-				}
-			} else {
-				fmt.Println("Warning: 'data.lifeLogs' is missing or not an array")
+	fmt.Printf("Fetching page %d...\n", page)
+	for raw, err := range client.Lifelogs(ctx, query) {
+		if err != nil {
+			if checkpointed && !errors.Is(err, errUnauthorized) {
+				fmt.Printf("Stopped at page %d. Run again with --resume to continue from there.\n", page)
 			}
-		} else {
-			fmt.Println("Warning: 'data' node missing or not a map")
-		}
-
-		if len(dataList) == 0 {
-			fmt.Println("No lifelogs found.")
-			break
+			return err
 		}
-		fmt.Printf("Found %d lifelogs\n", len(dataList))
+		saveLifelog(w, raw)
+	}
 
-		for _, raw := range dataList {
-			var item LimitlessLifelog
-			if err := json.Unmarshal(raw, &item); err != nil {
-				fmt.Println("Skipping malformed lifelog:", err)
-				continue
-			}
-			item.Raw = raw
-
-			export := PendantExport{
-				ID:            item.ID,
-				SourceType:    "limitless",
-				StartTime:     item.StartTime,
-				EndTime:       item.UpdatedAt,
-				Title:         item.Title,
-				Overview:      item.Summary,
-				Transcript:    item.Markdown,
-				Contents:      item.Contents,
-				UpdatedAt:     item.UpdatedAt,
-				IsStarred:     item.IsStarred,
-				ExportDate:    time.Now().UTC().Format(time.RFC3339),
-				ExportVersion: "Ainvil 2.0.0",
-				SourceFile:    "limitlessAPI",
-				Raw:           raw,
-			}
+	if err := w.SetCheckpoint("limitless", nil); err != nil {
+		return err
+	}
+	return w.Finish()
+}
 
-			// Determine output directory
-			t, err := time.Parse(time.RFC3339, export.StartTime)
-			if err != nil {
-				fmt.Printf("Warning: bad StartTime (%s) on lifelog %s, using current time\n", export.StartTime, export.ID)
-				t = time.Now().UTC()
-			}
-			outDir := filepath.Join(outputDir,
-				fmt.Sprintf("%04d", t.Year()),
-				fmt.Sprintf("%02d", t.Month()),
-				fmt.Sprintf("%02d", t.Day()))
-			os.MkdirAll(outDir, 0755)
-
-			outPath := filepath.Join(outDir, fmt.Sprintf("limitless_%s.json", export.ID))
-			if err := os.WriteFile(outPath, toJSON(export), 0644); err != nil {
-				fmt.Println("Failed to save", export.ID, ":", err)
-			} else {
-				fmt.Println("Saved", export.ID)
-			}
+// saveLifelog converts one lifelog from the API and saves it.
+func saveLifelog(w *ExportWriter, raw json.RawMessage) {
+	var item LimitlessLifelog
+	if err := json.Unmarshal(raw, &item); err != nil {
+		w.Reject("limitlessAPI", "limitless", fmt.Errorf("malformed lifelog: %w", err))
+		if !w.Opts.DryRun {
+			fmt.Println("Skipping malformed lifelog:", err)
 		}
+		return
+	}
+	item.Raw = raw
+	export := item.ToPendantExport()
 
-		// Detect nextCursor from meta.lifelog.nextCursor
-		meta, ok := rawResp["meta"].(map[string]interface{})
-		if !ok {
-			fmt.Println("No meta node. Ending pagination.")
-			break
+	source := "limitlessAPI:" + export.ID
+	if unchangedLifelog(w, export) {
+		entry := PlanEntry{
+			Source:     source,
+			SourceType: "limitless",
+			ID:         export.ID,
+			Target:     exportPath(w.OutDir, export),
+			Action:     ActionIdentical,
+			Reason:     "not edited since last sync",
+		}
+		w.Record(entry)
+		if !w.Opts.DryRun {
+			printSaved(export.ID, entry)
 		}
-		lifelogsMeta, ok := meta["lifelogs"].(map[string]interface{})
-		if !ok {
-			fmt.Println("No lifelog node in meta. Ending pagination.")
-			break
+		return
+	}
+
+	entry, err := w.Save(source, export)
+	if err != nil {
+		fmt.Println("Failed to save", export.ID, ":", err)
+	} else if !w.Opts.DryRun {
+		printSaved(export.ID, entry)
+	}
+}
+
+// ToPendantExport maps a lifelog onto the common export format. Its raw
+// API response is kept in Raw.
+func (item LimitlessLifelog) ToPendantExport() *PendantExport {
+	contents := limitlessContents(item.Contents)
+
+	transcript := item.Transcript
+	if transcript == "" {
+		transcript = blockquoteTranscript(contents)
+	}
+	if transcript == "" {
+		transcript = item.Markdown
+	}
+
+	return &PendantExport{
+		ID:            item.ID,
+		SourceType:    "limitless",
+		StartTime:     normalizeOrRaw("limitless", item.StartTime),
+		EndTime:       normalizeOrRaw("limitless", item.EndTime),
+		Title:         item.Title,
+		Overview:      item.Summary,
+		Transcript:    transcript,
+		Contents:      contents,
+		Markdown:      item.Markdown,
+		IsStarred:     item.IsStarred,
+		UpdatedAt:     item.UpdatedAt,
+		ExportDate:    time.Now().UTC().Format(time.RFC3339),
+		ExportVersion: GetVersion(),
+		SourceFile:    "limitlessAPI",
+		DeviceType:    item.Source.DeviceType,
+		Latitude:      string(item.Location.Latitude),
+		Longitude:     string(item.Location.Longitude),
+		Address:       item.Location.Address,
+		Tags:          item.Tags,
+		Raw:           item.Raw,
+	}
+}
+
+// limitlessContents copies a tree of content nodes, normalizing their times
+// like those of every other source.
+func limitlessContents(nodes []ContentEntry) []ContentEntry {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]ContentEntry, len(nodes))
+	for i, n := range nodes {
+		if n.StartTime != "" {
+			n.StartTime = normalizeOrRaw("limitless", n.StartTime)
 		}
-		nextCursorRaw, ok := lifelogsMeta["nextCursor"].(string)
-		if !ok || nextCursorRaw == "" {
-			fmt.Println("No nextCursor. Ending pagination.")
-			break
+		if n.EndTime != "" {
+			n.EndTime = normalizeOrRaw("limitless", n.EndTime)
 		}
+		n.Children = limitlessContents(n.Children)
+		out[i] = n
+	}
+	return out
+}
 
-		cursor = nextCursorRaw
-		page++
+// blockquoteTranscript renders the blockquote nodes of a content tree as
+// "Speaker: text" lines, the transcript format of the other sources.
+func blockquoteTranscript(nodes []ContentEntry) string {
+	var lines []string
+	var walk func(nodes []ContentEntry)
+	walk = func(nodes []ContentEntry) {
+		for _, n := range nodes {
+			if n.Type == "blockquote" && n.Content != "" {
+				if n.SpeakerName != "" {
+					lines = append(lines, n.SpeakerName+": "+n.Content)
+				} else {
+					lines = append(lines, n.Content)
+				}
+			}
+			walk(n.Children)
+		}
 	}
+	walk(nodes)
+	return strings.Join(lines, "\n")
+}
 
-	return nil
+// unchangedLifelog reports whether the local copy of export has the same
+// updatedAt, or a later one, so it needs neither reading nor rewriting.
+func unchangedLifelog(w *ExportWriter, export *PendantExport) bool {
+	if w.Opts.Policy == PolicyOverwrite {
+		return false
+	}
+	local, ok := w.Entry(exportPath(w.OutDir, export))
+	if !ok || local.ID != export.ID {
+		return false
+	}
+	remote, err := time.Parse(time.RFC3339, export.UpdatedAt)
+	if err != nil {
+		return false
+	}
+	saved, err := time.Parse(time.RFC3339, local.UpdatedAt)
+	return err == nil && !remote.After(saved)
 }
@@ -0,0 +1,136 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
+)
+
+// useSystemZone makes name the system zone, with no --tz or --source-tz,
+// for the rest of the test.
+func useSystemZone(t *testing.T, name string) {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevLocal, prevDefault, prevSources := time.Local, defaultLocation, sourceLocations
+	t.Cleanup(func() {
+		time.Local, defaultLocation, sourceLocations = prevLocal, prevDefault, prevSources
+	})
+	time.Local = loc
+	defaultLocation = time.Local
+	sourceLocations = map[string]*time.Location{}
+}
+
+// lifelogQueries serves empty lifelog pages and records the query of every
+// request.
+func lifelogQueries(t *testing.T) (*httptest.Server, func() []url.Values) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		w.Write([]byte(`{"data":{"lifelogs":[]},"meta":{"lifelogs":{}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+func TestLimitlessRangeInSystemZone(t *testing.T) {
+	silenceStdout(t)
+	useSystemZone(t, "America/Los_Angeles")
+
+	// 7:15 PM in Los Angeles is 02:15 the next day in UTC, which is how the
+	// API reads start and end when no timezone is sent.
+	const start, end = "2025-06-03T19:15:00-07:00", "2025-06-03T23:00:00-07:00"
+	const wantStart, wantEnd = "2025-06-04 02:15:00", "2025-06-04 06:00:00"
+
+	params, err := LimitlessOptions{End: end}.query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Has("timezone") {
+		t.Errorf("sent timezone %q for the system zone", params.Get("timezone"))
+	}
+	if got := params.Get("end"); got != wantEnd {
+		t.Errorf("end: got %q, want %q", got, wantEnd)
+	}
+
+	srv, queries := lifelogQueries(t)
+	if err := ParseLimitlessData(context.Background(), "key", srv.URL, start, t.TempDir(), LimitlessOptions{End: end}, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ainvil.NewSource("limitless", "key", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTime, _ := time.Parse(time.RFC3339, start)
+	endTime, _ := time.Parse(time.RFC3339, end)
+	if _, err := ainvil.Collect(s.Records(context.Background(), startTime, endTime)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := queries()
+	if len(got) != 2 {
+		t.Fatalf("got %d requests, want one from the CLI and one from the SDK", len(got))
+	}
+	for i, q := range got {
+		if q.Has("timezone") || q.Get("start") != wantStart || q.Get("end") != wantEnd {
+			t.Errorf("request %d: got timezone %q, start %q, end %q, want no timezone, %q, %q",
+				i, q.Get("timezone"), q.Get("start"), q.Get("end"), wantStart, wantEnd)
+		}
+	}
+}
+
+func TestLimitlessRangeInConfiguredZone(t *testing.T) {
+	useSystemZone(t, "America/Los_Angeles")
+	pinTimezones(t, "", "limitless=Europe/Berlin")
+
+	params, err := LimitlessOptions{End: "2025-06-03T19:15:00-07:00", Date: "2025-06-04"}.query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := params.Get("timezone"); got != "Europe/Berlin" {
+		t.Errorf("timezone: got %q, want Europe/Berlin", got)
+	}
+	if got := params.Get("end"); got != "2025-06-04 04:15:00" {
+		t.Errorf("end: got %q, want Berlin wall-clock time", got)
+	}
+	if got := limitlessTime("2025-06-04 09:00:00"); got != "2025-06-04 09:00:00" {
+		t.Errorf("API layout: got %q, want it passed on as given", got)
+	}
+}
@@ -26,9 +26,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 )
 
+func init() {
+	RegisterParser(Parser{Name: "omi", Sniff: sniffOmi, Parse: ParseOmiFile})
+}
+
+// sniffOmi matches the "Memory from ..." line Omi puts at the top of every
+// export.
+func sniffOmi(head []byte) bool {
+	return sniffLines(head, func(line string) bool {
+		return strings.HasPrefix(line, "Memory from ")
+	})
+}
+
 func ParseOmiFile(path string) (*PendantExport, error) {
 	// First, read entire file content for RAW preservation
 	rawFileBytes, err := os.ReadFile(path)
@@ -44,7 +58,7 @@ func ParseOmiFile(path string) (*PendantExport, error) {
 	}
 	defer file.Close()
 
-	var timestamp, title, overview string
+	var startTime, endTime, title, overview string
 	var transcriptLines []string
 	inTranscript := false
 
@@ -53,7 +67,7 @@ func ParseOmiFile(path string) (*PendantExport, error) {
 		line := strings.TrimSpace(scanner.Text())
 
 		if strings.HasPrefix(line, "Memory from ") {
-			timestamp = strings.TrimSpace(strings.TrimPrefix(line, "Memory from "))
+			startTime, endTime = parseOmiTimestamp(strings.TrimSpace(strings.TrimPrefix(line, "Memory from ")))
 		} else if strings.HasPrefix(line, "Title: ") {
 			title = strings.TrimSpace(strings.TrimPrefix(line, "Title: "))
 		} else if strings.HasPrefix(line, "Overview: ") {
@@ -76,15 +90,80 @@ func ParseOmiFile(path string) (*PendantExport, error) {
 	}
 
 	return &PendantExport{
-		StartTime:  timestamp,
+		StartTime:  startTime,
+		EndTime:    endTime,
 		Title:      title,
 		Overview:   overview,
 		Transcript: strings.Join(transcriptLines, "\n"),
-		Contents: []ContentEntry{
+		Contents: append([]ContentEntry{
 			{Type: "heading1", Content: title},
 			{Type: "heading2", Content: overview},
-			{Type: "paragraph", Content: strings.Join(transcriptLines, "\n")},
-		},
+		}, splitUtterances(transcriptLines, startTime)...),
 		Raw: rawJSON,
 	}, nil
 }
+
+var (
+	omiDateTimeLayouts = []string{
+		"Jan 2, 2006 at 3:04 PM",
+		"January 2, 2006 at 3:04 PM",
+		"Mon, Jan 2, 2006 at 3:04 PM",
+		"Monday, January 2, 2006 at 3:04 PM",
+		"Jan 2, 2006, 3:04 PM",
+		"January 2, 2006, 3:04 PM",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+	}
+	omiClockLayouts = []string{"3:04 PM", "3:04PM", "15:04"}
+	omiRangeRE      = regexp.MustCompile(`\s+(?:to|-|–|—)\s+`)
+)
+
+// parseOmiTimestamp parses the text after "Memory from ", which is either a
+// single timestamp or a range such as
+//
+//	Jun 4, 2025 at 9:00 AM to 9:30 AM
+//	Jun 4, 2025 at 11:50 PM to Jun 5, 2025 at 12:10 AM
+//
+// An end given as a bare clock time is on the start's date, or the next day
+// if that would put it before the start. Unparsed values are returned as is.
+func parseOmiTimestamp(raw string) (string, string) {
+	startRaw, endRaw := raw, ""
+	if loc := omiRangeRE.FindStringIndex(raw); loc != nil {
+		startRaw, endRaw = raw[:loc[0]], raw[loc[1]:]
+	}
+
+	start, err := ParseSourceTime("omi", startRaw, omiDateTimeLayouts...)
+	if err != nil {
+		fmt.Printf("Warning: couldn't parse Omi time %q: %v\n", raw, err)
+		return raw, "" // preserve original unparsed
+	}
+	if endRaw == "" {
+		return start.Format(time.RFC3339), ""
+	}
+
+	end, err := ParseSourceTime("omi", endRaw, omiDateTimeLayouts...)
+	if err != nil {
+		end, err = parseOmiClock(endRaw, start)
+	}
+	if err != nil {
+		fmt.Printf("Warning: couldn't parse Omi end time %q: %v\n", endRaw, err)
+		return start.Format(time.RFC3339), endRaw
+	}
+	return start.Format(time.RFC3339), end.Format(time.RFC3339)
+}
+
+// parseOmiClock reads a clock-only end time on the same day as start.
+func parseOmiClock(raw string, start time.Time) (time.Time, error) {
+	for _, layout := range omiClockLayouts {
+		c, err := time.Parse(layout, strings.TrimSpace(raw))
+		if err != nil {
+			continue
+		}
+		end := time.Date(start.Year(), start.Month(), start.Day(), c.Hour(), c.Minute(), 0, 0, start.Location())
+		if end.Before(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		return end, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", raw)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOmiTimestamp(t *testing.T) {
+	silenceStdout(t)
+	pinTimezones(t, "UTC")
+
+	tests := []struct {
+		raw        string
+		start, end string
+	}{
+		{"Jun 4, 2025 at 9:00 AM to 9:30 AM", "2025-06-04T09:00:00Z", "2025-06-04T09:30:00Z"},
+		{"Jun 4, 2025 at 11:50 PM to 12:10 AM", "2025-06-04T23:50:00Z", "2025-06-05T00:10:00Z"},
+		{"Jun 4, 2025 at 11:50 PM to Jun 5, 2025 at 12:10 AM", "2025-06-04T23:50:00Z", "2025-06-05T00:10:00Z"},
+		{"June 4, 2025 at 9:00 AM – 9:30AM", "2025-06-04T09:00:00Z", "2025-06-04T09:30:00Z"},
+		{"Wed, Jun 4, 2025 at 9:00 AM - 10:15 AM", "2025-06-04T09:00:00Z", "2025-06-04T10:15:00Z"},
+		{"2025-06-04 22:00 - 01:30", "2025-06-04T22:00:00Z", "2025-06-05T01:30:00Z"},
+		{"Jun 4, 2025 at 9:00 AM", "2025-06-04T09:00:00Z", ""},
+		{"Jun 4, 2025 at 9:00 AM to whenever", "2025-06-04T09:00:00Z", "whenever"},
+		{"sometime yesterday", "sometime yesterday", ""},
+	}
+	for _, tt := range tests {
+		start, end := parseOmiTimestamp(tt.raw)
+		if start != tt.start || end != tt.end {
+			t.Errorf("%q: got %q - %q, want %q - %q", tt.raw, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseOmiTimestampSourceZone(t *testing.T) {
+	pinTimezones(t, "UTC", "omi=America/New_York")
+
+	start, end := parseOmiTimestamp("Jun 4, 2025 at 11:50 PM to 12:10 AM")
+	if start != "2025-06-04T23:50:00-04:00" || end != "2025-06-05T00:10:00-04:00" {
+		t.Errorf("got %s - %s", start, end)
+	}
+}
+
+func TestParseOmiFilePastMidnight(t *testing.T) {
+	pinTimezones(t, "UTC")
+
+	export, err := ParseOmiFile(filepath.Join("testdata", "mixed", "omi_late.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.StartTime != "2025-06-04T23:50:00Z" || export.EndTime != "2025-06-05T00:10:00Z" {
+		t.Fatalf("got %s - %s", export.StartTime, export.EndTime)
+	}
+	if export.Title != "Late" {
+		t.Errorf("title %q", export.Title)
+	}
+}
@@ -0,0 +1,607 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OverwritePolicy decides what happens when an export's target file already
+// exists.
+type OverwritePolicy string
+
+const (
+	// PolicySkip never touches an existing file.
+	PolicySkip OverwritePolicy = "skip"
+	// PolicyOverwrite always rewrites the file, even if nothing changed.
+	PolicyOverwrite OverwritePolicy = "overwrite"
+	// PolicyUpdateIfChanged rewrites the file only when its content, ignoring
+	// exportDate, differs.
+	PolicyUpdateIfChanged OverwritePolicy = "update-if-changed"
+	// PolicyKeepBoth leaves the existing file alone and writes a changed
+	// export next to it as <sourceType>_<id>_<n>.json.
+	PolicyKeepBoth OverwritePolicy = "keep-both"
+)
+
+var overwritePolicies = []OverwritePolicy{PolicySkip, PolicyOverwrite, PolicyUpdateIfChanged, PolicyKeepBoth}
+
+// ParseOverwritePolicy validates a --overwrite-policy value. Empty means
+// PolicyUpdateIfChanged.
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	if s == "" {
+		return PolicyUpdateIfChanged, nil
+	}
+	for _, p := range overwritePolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	names := make([]string, len(overwritePolicies))
+	for i, p := range overwritePolicies {
+		names[i] = string(p)
+	}
+	return "", fmt.Errorf("invalid overwrite policy %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// ImportOptions are the settings shared by every import command.
+type ImportOptions struct {
+	// DryRun reports what would be written without touching the output tree.
+	DryRun bool
+	// PlanOutput, if set, is where the plan of the run is written as JSON.
+	PlanOutput string
+	// Policy decides what happens to files that already exist.
+	Policy OverwritePolicy
+	// KeepHistory copies a file about to be overwritten into
+	// out/.ainvil/history first.
+	KeepHistory bool
+	// Workers is how many files are parsed and written in parallel.
+	// Values below 1 mean one worker per CPU.
+	Workers int
+	// Recursive descends into subfolders of the source directory.
+	Recursive bool
+	// Include and Exclude are glob patterns selecting source files. An
+	// empty Include means the importer's default, usually "*.txt".
+	Include []string
+	Exclude []string
+	// Watch keeps the import running and picks up files as they appear
+	// or change. See WatchState.
+	Watch bool
+	// WatchDebounce is how long a file must stay unchanged before a watch
+	// imports it.
+	WatchDebounce time.Duration
+	// WatchState is the watch state file. Empty means
+	// <out>/.ainvil/watch.json.
+	WatchState string
+}
+
+type PlanAction string
+
+const (
+	ActionCreate    PlanAction = "create"
+	ActionOverwrite PlanAction = "overwrite"
+	ActionIdentical PlanAction = "identical"
+	ActionSkip      PlanAction = "skip"
+	ActionKeepBoth  PlanAction = "keep-both"
+	ActionReject    PlanAction = "reject"
+)
+
+// PlanEntry is the decision taken for one imported entry.
+type PlanEntry struct {
+	Source     string     `json:"source"`
+	SourceType string     `json:"sourceType,omitempty"`
+	ID         string     `json:"id,omitempty"`
+	Target     string     `json:"target,omitempty"`
+	Action     PlanAction `json:"action"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// Plan is the machine readable record written by --plan-output.
+type Plan struct {
+	DryRun      bool               `json:"dryRun"`
+	GeneratedAt string             `json:"generatedAt"`
+	OutDir      string             `json:"outDir"`
+	Summary     map[PlanAction]int `json:"summary"`
+	Entries     []PlanEntry        `json:"entries"`
+}
+
+// ExportWriter saves exports into the output tree on behalf of the import
+// commands. It decides per entry, according to the overwrite policy, whether
+// it is new, replaces the existing file, is identical to it, is skipped or is
+// kept next to it, and records every decision in a plan. In dry-run mode
+// nothing is written.
+//
+// Save and write may be called from several goroutines at once.
+type ExportWriter struct {
+	OutDir string
+	Opts   ImportOptions
+
+	mu       sync.Mutex
+	plan     Plan
+	lock     *OutLock
+	manifest *Manifest
+	synced   map[string]bool // source types written in this run
+	targets  sync.Map        // target path -> *sync.Mutex
+}
+
+// NewExportWriter prepares a writer for outDir. Unless this is a dry run it
+// takes the lock on outDir, which is held until Finish or Close, and keeps
+// the manifest of outDir up to date as it writes.
+func NewExportWriter(outDir string, opts ImportOptions) (*ExportWriter, error) {
+	if opts.Policy == "" {
+		opts.Policy = PolicyUpdateIfChanged
+	}
+
+	var lock *OutLock
+	if !opts.DryRun {
+		var err error
+		if lock, err = LockOutDir(outDir, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := OpenManifest(outDir)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+
+	return &ExportWriter{
+		OutDir: outDir,
+		Opts:   opts,
+		plan: Plan{
+			DryRun:  opts.DryRun,
+			OutDir:  outDir,
+			Summary: map[PlanAction]int{},
+		},
+		lock:     lock,
+		manifest: manifest,
+		synced:   map[string]bool{},
+	}, nil
+}
+
+// Close saves the manifest and releases the lock on the output tree. It is
+// safe to call more than once.
+func (w *ExportWriter) Close() error {
+	var err error
+	if !w.Opts.DryRun {
+		w.mu.Lock()
+		err = w.manifest.Save(w.OutDir)
+		w.mu.Unlock()
+	}
+	w.lock.Unlock()
+	return err
+}
+
+// Cursor returns the newest updatedAt already imported from sourceType, or
+// the zero time if there is none.
+func (w *ExportWriter) Cursor(sourceType string) time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.manifest.Cursor(sourceType)
+}
+
+// Save writes export as the overwrite policy dictates, unless this is a dry
+// run. source names where the export came from.
+func (w *ExportWriter) Save(source string, export *PendantExport) (PlanEntry, error) {
+	entry, err := w.write(source, export)
+	w.Record(entry)
+	return entry, err
+}
+
+// write is Save without recording the entry in the plan, for callers that
+// record results in their own order.
+func (w *ExportWriter) write(source string, export *PendantExport) (PlanEntry, error) {
+	flagUnparsedTimes(export)
+	target := exportPath(w.OutDir, export)
+
+	// Two inputs can resolve to the same target; decide and write for one
+	// target at a time.
+	m, _ := w.targets.LoadOrStore(target, &sync.Mutex{})
+	m.(*sync.Mutex).Lock()
+	defer m.(*sync.Mutex).Unlock()
+
+	entry := PlanEntry{
+		Source:     source,
+		SourceType: export.SourceType,
+		ID:         export.ID,
+		Reason:     export.TimeError,
+	}
+	entry.Action, entry.Target = w.decide(target, export)
+
+	var moved []string
+	if entry.Action == ActionCreate {
+		moved = w.movedFrom(target, export)
+		for _, old := range moved {
+			entry.Reason = joinReason(entry.Reason, "moved from "+old)
+		}
+	}
+
+	if w.Opts.DryRun {
+		return entry, nil
+	}
+	if entry.Action == ActionOverwrite && w.Opts.KeepHistory {
+		if err := w.keepHistory(entry.Target); err != nil {
+			return rejectEntry(source, export.SourceType, err), err
+		}
+	}
+	if entry.Action == ActionCreate || entry.Action == ActionOverwrite || entry.Action == ActionKeepBoth {
+		if err := writeExport(entry.Target, export); err != nil {
+			return rejectEntry(source, export.SourceType, err), err
+		}
+	}
+	if entry.Action != ActionSkip {
+		w.mu.Lock()
+		w.manifest.addEntry(w.OutDir, entry.Target, export)
+		w.synced[export.SourceType] = true
+		w.mu.Unlock()
+	}
+	for _, old := range moved {
+		if err := w.removeMoved(old); err != nil {
+			fmt.Printf("Warning: removing the old copy of %s at %s: %v\n", export.ID, old, err)
+		}
+	}
+
+	return entry, nil
+}
+
+// movedFrom returns where the export was saved before, if its target has
+// changed since. An export keeps its ID when only its day folder changes,
+// for instance when a newer version parses a time it could not. When a
+// source file's times are read in another zone its ID changes too; the
+// export its file produced last time is then the old copy, provided it
+// holds the same transcript.
+func (w *ExportWriter) movedFrom(target string, export *PendantExport) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name := filepath.Base(target)
+	targetKey := manifestKey(w.OutDir, target)
+	var keys []string
+	if export.ID != "" {
+		for _, key := range w.manifest.entriesWithID(export.SourceType, export.ID) {
+			// Copies kept by keep-both are named <sourceType>_<id>_<n>.json
+			// and stay where they are.
+			if key != targetKey && filepath.Base(filepath.FromSlash(key)) == name {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if f, ok := w.manifest.Files[export.SourceFile]; ok && f.Entry != targetKey && !slices.Contains(keys, f.Entry) {
+		e, ok := w.manifest.Entries[f.Entry]
+		old := filepath.Join(w.OutDir, filepath.FromSlash(f.Entry))
+		if ok && e.SourceType == export.SourceType && e.SourceFile == export.SourceFile && sameRecording(old, export) {
+			keys = append(keys, f.Entry)
+		}
+	}
+
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		paths[i] = filepath.Join(w.OutDir, filepath.FromSlash(key))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sameRecording reports whether the export saved at path has the same
+// transcript as export, or the same raw data if neither has a transcript.
+func sameRecording(path string, export *PendantExport) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var old PendantExport
+	if err := json.Unmarshal(data, &old); err != nil {
+		return false
+	}
+	a := strings.Join(strings.Fields(old.Transcript), " ")
+	b := strings.Join(strings.Fields(export.Transcript), " ")
+	if a == "" && b == "" {
+		return bytes.Equal(old.Raw, export.Raw)
+	}
+	return a == b
+}
+
+// removeMoved deletes the old copy of an export that was saved elsewhere,
+// keeping it in the history first if asked to.
+func (w *ExportWriter) removeMoved(path string) error {
+	if w.Opts.KeepHistory {
+		if err := w.keepHistory(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.forget(path)
+	return nil
+}
+
+// joinReason appends reason to the plan reason so far.
+func joinReason(reasons, reason string) string {
+	if reasons == "" {
+		return reason
+	}
+	return reasons + "; " + reason
+}
+
+// keepHistory copies the export at target to
+// out/.ainvil/history/<sourceType>/<id>/<version>.json, where version is its
+// updatedAt, or its exportDate for sources without one.
+func (w *ExportWriter) keepHistory(target string) error {
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	var old PendantExport
+	if err := json.Unmarshal(data, &old); err != nil {
+		return fmt.Errorf("reading %s for history: %w", target, err)
+	}
+
+	version := old.UpdatedAt
+	if version == "" {
+		version = old.ExportDate
+	}
+	if version == "" {
+		version = time.Now().UTC().Format(time.RFC3339)
+	}
+	dir := filepath.Join(w.OutDir, stateDir, "history", old.SourceType, old.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, strings.ReplaceAll(version, ":", "-")+".json"), data, 0644)
+}
+
+// Checkpoint returns where an interrupted sync of sourceType left off, or
+// nil.
+func (w *ExportWriter) Checkpoint(sourceType string) *SyncCheckpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if s, ok := w.manifest.Sources[sourceType]; ok {
+		return s.Checkpoint
+	}
+	return nil
+}
+
+// SetCheckpoint records cp for sourceType, or clears it if cp is nil, and
+// saves the manifest straight away so that the checkpoint and the entries
+// written so far survive a crash.
+func (w *ExportWriter) SetCheckpoint(sourceType string, cp *SyncCheckpoint) error {
+	if w.Opts.DryRun {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cp != nil {
+		cp.SavedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	w.manifest.source(sourceType).Checkpoint = cp
+	w.manifest.dirty = true
+	return w.manifest.Save(w.OutDir)
+}
+
+// entryKeys returns the sorted manifest keys of the exports of sourceType.
+func (w *ExportWriter) entryKeys(sourceType string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var keys []string
+	for key, e := range w.manifest.Entries {
+		if e.SourceType == sourceType {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// forget drops the export at path from the manifest after it was removed.
+func (w *ExportWriter) forget(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest.removeEntry(w.OutDir, path)
+}
+
+// Entry returns the manifest entry of the export that would be saved at
+// target, if there is one.
+func (w *ExportWriter) Entry(target string) (ManifestEntry, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.manifest.Entries[manifestKey(w.OutDir, target)]
+	return e, ok
+}
+
+// recordSource notes in the manifest that the source file name, with the
+// given checksum, was imported into target, reading its times in the zone
+// of sourceType.
+func (w *ExportWriter) recordSource(name, checksum, sourceType, target string) {
+	if w.Opts.DryRun {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest.Files[name] = SourceFileState{
+		Checksum:      checksum,
+		Entry:         manifestKey(w.OutDir, target),
+		ExportVersion: GetVersion(),
+		Zone:          SourceLocation(sourceType).String(),
+	}
+	w.manifest.dirty = true
+}
+
+// unchangedSource returns the plan entry for a source file that was already
+// imported with the same checksum, unless the policy asks for every file to
+// be rewritten.
+func (w *ExportWriter) unchangedSource(name, checksum string) (PlanEntry, bool) {
+	if w.Opts.Policy == PolicyOverwrite {
+		return PlanEntry{}, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key, ok := w.manifest.unchangedSource(w.OutDir, name, checksum)
+	if !ok {
+		return PlanEntry{}, false
+	}
+	e := w.manifest.Entries[key]
+	return PlanEntry{
+		Source:     name,
+		SourceType: e.SourceType,
+		ID:         e.ID,
+		Target:     filepath.Join(w.OutDir, filepath.FromSlash(key)),
+		Action:     ActionIdentical,
+		Reason:     "source file unchanged since last import",
+	}, true
+}
+
+// decide picks the action for export and the path it goes to.
+func (w *ExportWriter) decide(target string, export *PendantExport) (PlanAction, string) {
+	existing, err := os.ReadFile(target)
+	if err != nil {
+		return ActionCreate, target
+	}
+
+	switch w.Opts.Policy {
+	case PolicySkip:
+		return ActionSkip, target
+	case PolicyOverwrite:
+		return ActionOverwrite, target
+	case PolicyKeepBoth:
+		if sameContent(existing, export) {
+			return ActionIdentical, target
+		}
+		base := strings.TrimSuffix(target, ".json")
+		for n := 2; ; n++ {
+			alt := fmt.Sprintf("%s_%d.json", base, n)
+			data, err := os.ReadFile(alt)
+			if err != nil {
+				return ActionKeepBoth, alt
+			}
+			if sameContent(data, export) {
+				return ActionIdentical, alt
+			}
+		}
+	default:
+		if sameContent(existing, export) {
+			return ActionIdentical, target
+		}
+		return ActionOverwrite, target
+	}
+}
+
+// Reject records an entry that could not be imported.
+func (w *ExportWriter) Reject(source, sourceType string, err error) PlanEntry {
+	entry := rejectEntry(source, sourceType, err)
+	w.Record(entry)
+	return entry
+}
+
+func rejectEntry(source, sourceType string, err error) PlanEntry {
+	return PlanEntry{
+		Source:     source,
+		SourceType: sourceType,
+		Action:     ActionReject,
+		Reason:     err.Error(),
+	}
+}
+
+// Record adds entry to the plan, echoing it in dry-run mode.
+func (w *ExportWriter) Record(entry PlanEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.plan.Entries = append(w.plan.Entries, entry)
+	w.plan.Summary[entry.Action]++
+
+	if w.Opts.DryRun {
+		fmt.Printf("[dry-run] %-9s %s", entry.Action, entry.Source)
+		if entry.Target != "" {
+			fmt.Printf(" -> %s", entry.Target)
+		}
+		if entry.Reason != "" {
+			fmt.Printf(" (%s)", entry.Reason)
+		}
+		fmt.Println()
+	}
+}
+
+// Finish prints the summary of the run, writes the plan file if one was
+// requested, saves the manifest and releases the lock.
+func (w *ExportWriter) Finish() error {
+	w.mu.Lock()
+	for sourceType := range w.synced {
+		w.manifest.synced(sourceType)
+	}
+	w.mu.Unlock()
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	s := w.plan.Summary
+	prefix := "Done. "
+	if w.Opts.DryRun {
+		prefix = "Done (dry run, nothing written). Would have: "
+	}
+	fmt.Printf("%s%d created, %d updated, %d unchanged", prefix, s[ActionCreate], s[ActionOverwrite], s[ActionIdentical])
+	if s[ActionKeepBoth] > 0 {
+		fmt.Printf(", %d kept alongside existing", s[ActionKeepBoth])
+	}
+	if s[ActionSkip] > 0 {
+		fmt.Printf(", %d skipped (already exist)", s[ActionSkip])
+	}
+	if s[ActionReject] > 0 {
+		fmt.Printf(", %d rejected", s[ActionReject])
+	}
+	fmt.Println()
+
+	if w.Opts.PlanOutput == "" {
+		return nil
+	}
+	w.plan.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := writeFileAtomic(w.Opts.PlanOutput, toJSON(w.plan), 0644); err != nil {
+		return fmt.Errorf("writing plan: %w", err)
+	}
+	fmt.Println("Plan written to", w.Opts.PlanOutput)
+	return nil
+}
+
+// sameContent reports whether the JSON in existing holds the same export,
+// ignoring ExportDate.
+func sameContent(existing []byte, export *PendantExport) bool {
+	var old PendantExport
+	if err := json.Unmarshal(existing, &old); err != nil {
+		return false
+	}
+	old.ExportDate = ""
+	fresh := *export
+	fresh.ExportDate = ""
+
+	a, errA := json.Marshal(old)
+	b, errB := json.Marshal(fresh)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSameContent(t *testing.T) {
+	export := &PendantExport{ID: "a", SourceType: "bee", Title: "Lunch", ExportDate: "2025-06-01T00:00:00Z"}
+	later := *export
+	later.ExportDate = "2025-07-01T00:00:00Z"
+	changed := *export
+	changed.Title = "Dinner"
+
+	tests := []struct {
+		name     string
+		existing []byte
+		export   *PendantExport
+		want     bool
+	}{
+		{"same", toJSON(export), export, true},
+		{"only exportDate differs", toJSON(export), &later, true},
+		{"changed", toJSON(export), &changed, false},
+		{"not json", []byte("{"), export, false},
+	}
+	for _, tt := range tests {
+		if got := sameContent(tt.existing, tt.export); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	export := &PendantExport{ID: "a", SourceType: "bee", Title: "Lunch"}
+	changed := *export
+	changed.Title = "Dinner"
+
+	tests := []struct {
+		policy   OverwritePolicy
+		existing *PendantExport // nil: no file yet
+		want     PlanAction
+	}{
+		{PolicySkip, nil, ActionCreate},
+		{PolicySkip, export, ActionSkip},
+		{PolicySkip, &changed, ActionSkip},
+		{PolicyOverwrite, nil, ActionCreate},
+		{PolicyOverwrite, export, ActionOverwrite},
+		{PolicyOverwrite, &changed, ActionOverwrite},
+		{PolicyUpdateIfChanged, nil, ActionCreate},
+		{PolicyUpdateIfChanged, export, ActionIdentical},
+		{PolicyUpdateIfChanged, &changed, ActionOverwrite},
+		{PolicyKeepBoth, nil, ActionCreate},
+		{PolicyKeepBoth, export, ActionIdentical},
+		{PolicyKeepBoth, &changed, ActionKeepBoth},
+	}
+	for _, tt := range tests {
+		target := filepath.Join(t.TempDir(), "bee_a.json")
+		if tt.existing != nil {
+			if err := os.WriteFile(target, toJSON(tt.existing), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w := &ExportWriter{Opts: ImportOptions{Policy: tt.policy}}
+
+		action, path := w.decide(target, export)
+		wantPath := target
+		if tt.want == ActionKeepBoth {
+			wantPath = filepath.Join(filepath.Dir(target), "bee_a_2.json")
+		}
+		if action != tt.want || path != wantPath {
+			t.Errorf("%s with existing %v: got %s -> %s, want %s -> %s",
+				tt.policy, tt.existing != nil, action, path, tt.want, wantPath)
+		}
+	}
+}
+
+func TestDecideKeepBothNaming(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "bee_a.json")
+	write := func(name, title string) {
+		t.Helper()
+		data := toJSON(&PendantExport{ID: "a", SourceType: "bee", Title: title})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("bee_a.json", "v1")
+	write("bee_a_2.json", "v2")
+	write("bee_a_3.json", "v3")
+
+	w := &ExportWriter{Opts: ImportOptions{Policy: PolicyKeepBoth}}
+	tests := []struct {
+		title string
+		want  PlanAction
+		file  string
+	}{
+		{"v1", ActionIdentical, "bee_a.json"},
+		{"v2", ActionIdentical, "bee_a_2.json"},
+		{"v3", ActionIdentical, "bee_a_3.json"},
+		{"v4", ActionKeepBoth, "bee_a_4.json"},
+	}
+	for _, tt := range tests {
+		action, path := w.decide(target, &PendantExport{ID: "a", SourceType: "bee", Title: tt.title})
+		if action != tt.want || path != filepath.Join(dir, tt.file) {
+			t.Errorf("%s: got %s -> %s, want %s -> %s", tt.title, action, filepath.Base(path), tt.want, tt.file)
+		}
+	}
+}
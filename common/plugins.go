@@ -0,0 +1,292 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// pluginPrefix starts the name of every parser plugin executable.
+	pluginPrefix = "ainvil-parser-"
+	// pluginProtocol is the handshake version this ainvil speaks.
+	pluginProtocol   = 1
+	handshakeTimeout = 5 * time.Second
+	pluginTimeout    = 2 * time.Minute
+)
+
+// pluginNameRE is what a plugin name must look like. The name ends up in
+// export file names and the manifest, so it is kept to a lowercase slug.
+var pluginNameRE = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// PluginHandshake is what a parser plugin prints on stdout when run with
+// the "handshake" argument.
+type PluginHandshake struct {
+	// Protocol is the plugin protocol version, currently 1.
+	Protocol int `json:"protocol"`
+	// Name is the source type of the plugin's exports: lowercase letters
+	// and digits, optionally separated by single dashes. It defaults to the
+	// part of the executable name after "ainvil-parser-", lowercased.
+	Name string `json:"name,omitempty"`
+	// Extensions limits the plugin to files with these extensions, such as
+	// ".otter". Empty means any extension.
+	Extensions []string `json:"extensions,omitempty"`
+	// Sniff holds regular expressions matched against the first 4 KiB of a
+	// file; one match claims the file. ^ and $ match at line breaks.
+	Sniff []string `json:"sniff,omitempty"`
+	// Stdin asks for the file contents on stdin instead of its path.
+	Stdin bool `json:"stdin,omitempty"`
+}
+
+// Plugin is a parser plugin found on disk.
+type Plugin struct {
+	Path      string
+	Handshake PluginHandshake
+	patterns  []*regexp.Regexp
+}
+
+// DefaultPluginDir is the folder searched for plugins before PATH:
+// ainvil/parsers under the user's config directory.
+func DefaultPluginDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ainvil", "parsers")
+}
+
+// FindPlugins returns the ainvil-parser-* executables in dirs and then on
+// PATH. When two have the same name, the first one found wins.
+func FindPlugins(dirs []string) []string {
+	search := append([]string(nil), dirs...)
+	search = append(search, filepath.SplitList(os.Getenv("PATH"))...)
+
+	seen := map[string]bool{}
+	var found []string
+	for _, dir := range search {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			base := pluginBase(name)
+			if !strings.HasPrefix(base, pluginPrefix) || base == pluginPrefix || seen[base] {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if !isExecutable(path) {
+				continue
+			}
+			seen[base] = true
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// pluginBase strips the executable extension Windows requires.
+func pluginBase(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(path), ".exe")
+	}
+	return info.Mode()&0111 != 0
+}
+
+// OpenPlugin runs the handshake of the plugin at path.
+func OpenPlugin(path string) (*Plugin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	out, err := runPlugin(ctx, path, nil, "handshake")
+	if err != nil {
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+
+	var hs PluginHandshake
+	if err := json.Unmarshal(out, &hs); err != nil {
+		return nil, fmt.Errorf("handshake: invalid JSON: %w", err)
+	}
+	if hs.Protocol != pluginProtocol {
+		return nil, fmt.Errorf("handshake: unsupported protocol %d, want %d", hs.Protocol, pluginProtocol)
+	}
+	if hs.Name == "" {
+		hs.Name = strings.ToLower(strings.TrimPrefix(pluginBase(filepath.Base(path)), pluginPrefix))
+	}
+	if !pluginNameRE.MatchString(hs.Name) {
+		return nil, fmt.Errorf("handshake: invalid name %q: use lowercase letters, digits and dashes", hs.Name)
+	}
+	if len(hs.Extensions) == 0 && len(hs.Sniff) == 0 {
+		return nil, errors.New("handshake: declares neither extensions nor sniff patterns")
+	}
+	for i, ext := range hs.Extensions {
+		if !strings.HasPrefix(ext, ".") {
+			hs.Extensions[i] = "." + ext
+		}
+	}
+
+	p := &Plugin{Path: path, Handshake: hs}
+	for _, pattern := range hs.Sniff {
+		re, err := regexp.Compile("(?m)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("handshake: bad sniff pattern %q: %w", pattern, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// Sniff reports whether head matches one of the plugin's patterns. A plugin
+// without patterns takes every file with one of its extensions.
+func (p *Plugin) Sniff(head []byte) bool {
+	if len(p.patterns) == 0 {
+		return true
+	}
+	for _, re := range p.patterns {
+		if re.Match(head) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse runs the plugin on the file at path and decodes the export it
+// prints.
+func (p *Plugin) Parse(path string) (*PendantExport, error) {
+	return p.ParseContext(context.Background(), path)
+}
+
+// ParseContext is Parse, killing the plugin when ctx is done.
+func (p *Plugin) ParseContext(ctx context.Context, path string) (*PendantExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+
+	var out []byte
+	var err error
+	if p.Handshake.Stdin {
+		f, ferr := os.Open(path)
+		if ferr != nil {
+			return nil, fmt.Errorf("opening file: %v", ferr)
+		}
+		defer f.Close()
+		out, err = runPlugin(ctx, p.Path, f, "parse", "-")
+	} else {
+		out, err = runPlugin(ctx, p.Path, nil, "parse", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.Handshake.Name, err)
+	}
+
+	var export PendantExport
+	if err := json.Unmarshal(out, &export); err != nil {
+		return nil, fmt.Errorf("plugin %s: invalid export JSON: %w", p.Handshake.Name, err)
+	}
+	return &export, nil
+}
+
+// Parser returns the plugin as a registry entry.
+func (p *Plugin) Parser() Parser {
+	return Parser{
+		Name:         p.Handshake.Name,
+		Extensions:   p.Handshake.Extensions,
+		Sniff:        p.Sniff,
+		Parse:        p.Parse,
+		ParseContext: p.ParseContext,
+	}
+}
+
+// runPlugin runs the plugin with args and returns its stdout. A non-zero
+// exit becomes an error carrying the plugin's stderr.
+func runPlugin(ctx context.Context, path string, stdin *os.File, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	// Children a killed plugin leaves behind must not keep the pipes, and
+	// with them the import, waiting.
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, truncate(msg, 500))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// LoadPlugins finds the parser plugins in dirs and on PATH, runs their
+// handshakes and registers them after the built-in parsers. Plugins that
+// fail the handshake or reuse a registered name are reported and skipped.
+// It returns the plugins that were registered.
+func LoadPlugins(dirs []string) []*Plugin {
+	var loaded []*Plugin
+	for _, path := range FindPlugins(dirs) {
+		p, err := OpenPlugin(path)
+		if err != nil {
+			fmt.Printf("Skipping plugin %s: %v\n", path, err)
+			continue
+		}
+		if err := AddParser(p.Parser()); err != nil {
+			fmt.Printf("Skipping plugin %s: %v\n", path, err)
+			continue
+		}
+		loaded = append(loaded, p)
+	}
+	return loaded
+}
@@ -0,0 +1,231 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
+)
+
+var testPluginDir = filepath.Join("testdata", "plugins")
+
+// openTestPlugin runs the handshake of the named plugin in testdata.
+func openTestPlugin(t *testing.T, name string) *Plugin {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell scripts")
+	}
+	p, err := OpenPlugin(filepath.Join(testPluginDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func writeOtter(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "meeting.otter")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFindPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell scripts")
+	}
+	var found []string
+	for _, path := range FindPlugins([]string{testPluginDir}) {
+		if filepath.Dir(path) == testPluginDir {
+			found = append(found, filepath.Base(path))
+		}
+	}
+	// The non-executable ainvil-parser-notes is left out.
+	want := []string{"ainvil-parser-future", "ainvil-parser-otter", "ainvil-parser-otter-stdin"}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("got %q, want %q", found, want)
+	}
+}
+
+func TestOpenPlugin(t *testing.T) {
+	p := openTestPlugin(t, "ainvil-parser-otter")
+	want := PluginHandshake{Protocol: 1, Name: "otter", Extensions: []string{".otter"}, Sniff: []string{"^OTTER "}}
+	if !reflect.DeepEqual(p.Handshake, want) {
+		t.Errorf("handshake: got %+v, want %+v", p.Handshake, want)
+	}
+	if !p.Sniff([]byte("x\nOTTER Standup\n")) || p.Sniff([]byte("Memory from Jun 4\n")) {
+		t.Error("sniff patterns do not match line starts only")
+	}
+
+	in := openTestPlugin(t, "ainvil-parser-otter-stdin")
+	if in.Handshake.Name != "otterin" || !in.Handshake.Stdin || !reflect.DeepEqual(in.Handshake.Extensions, []string{".otter"}) {
+		t.Errorf("stdin handshake: got %+v", in.Handshake)
+	}
+	if !in.Sniff([]byte("anything")) {
+		t.Error("a plugin without sniff patterns should take every file")
+	}
+
+	_, err := OpenPlugin(filepath.Join(testPluginDir, "ainvil-parser-future"))
+	if err == nil || !strings.Contains(err.Error(), "unsupported protocol 2") {
+		t.Errorf("future protocol: got %v", err)
+	}
+}
+
+func TestPluginParse(t *testing.T) {
+	path := writeOtter(t, "OTTER Standup\nhello\n")
+
+	for _, name := range []string{"ainvil-parser-otter", "ainvil-parser-otter-stdin"} {
+		t.Run(name, func(t *testing.T) {
+			p := openTestPlugin(t, name)
+			export, err := p.Parser().parse(context.Background(), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if export.Title != "Standup" || export.StartTime != "2025-06-03T19:15:00Z" {
+				t.Errorf("got title %q, start %q", export.Title, export.StartTime)
+			}
+			wantArg := path
+			if p.Handshake.Stdin {
+				wantArg = "-"
+			}
+			if export.Transcript != "from "+wantArg {
+				t.Errorf("plugin was given %q, want %q", strings.TrimPrefix(export.Transcript, "from "), wantArg)
+			}
+		})
+	}
+
+	p := openTestPlugin(t, "ainvil-parser-otter")
+	_, err := p.Parse(writeOtter(t, "OTTER FAIL\n"))
+	if err == nil || !strings.Contains(err.Error(), "cannot parse this otter") {
+		t.Errorf("failing plugin: got %v, want its stderr", err)
+	}
+}
+
+func TestPluginParseCancelled(t *testing.T) {
+	p := openTestPlugin(t, "ainvil-parser-otter")
+	path := writeOtter(t, "OTTER SLEEP\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	began := time.Now()
+	_, err := p.ParseContext(ctx, path)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's error", err)
+	}
+	if d := time.Since(began); d > 5*time.Second {
+		t.Errorf("cancelled plugin took %s to stop", d)
+	}
+}
+
+func TestProcessFilesStopsPlugins(t *testing.T) {
+	silenceStdout(t)
+	p := openTestPlugin(t, "ainvil-parser-otter")
+	paths := []string{writeOtter(t, "OTTER SLEEP\n"), writeOtter(t, "OTTER SLEEP\n")}
+	resolve := func(string) (Parser, error) { return p.Parser(), nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	began := time.Now()
+	_, err := processFiles(ctx, localSources(paths), t.TempDir(), ImportOptions{Workers: 1}, resolve)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the import to report cancellation", err)
+	}
+	if d := time.Since(began); d > 5*time.Second {
+		t.Errorf("import took %s to stop after Ctrl-C", d)
+	}
+}
+
+// writePlugin writes a plugin named file into dir that answers the
+// handshake with handshake.
+func writePlugin(t *testing.T, dir, file, handshake string) string {
+	t.Helper()
+	path := filepath.Join(dir, file)
+	script := "#!/bin/sh\n[ \"$1\" = handshake ] && echo '" + handshake + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenPluginNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell scripts")
+	}
+	dir := t.TempDir()
+
+	p, err := OpenPlugin(writePlugin(t, dir, "ainvil-parser-Shout", `{"protocol":1,"extensions":[".shout"]}`))
+	if err != nil || p.Handshake.Name != "shout" {
+		t.Errorf("default name: got %v, %v", p, err)
+	}
+
+	for _, name := range []string{"../../escape", "Otter", "otter notes", "otter_notes", "-otter", "otter--notes", "otter/notes"} {
+		path := writePlugin(t, dir, "ainvil-parser-bad", `{"protocol":1,"name":"`+name+`","extensions":[".bad"]}`)
+		if _, err := OpenPlugin(path); err == nil || !strings.Contains(err.Error(), "invalid name") {
+			t.Errorf("name %q: got %v, want it refused", name, err)
+		}
+	}
+}
+
+func TestLoadPluginsSkipsTakenNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell scripts")
+	}
+	silenceStdout(t)
+	// A file source registered through the SDK only, not as a parser.
+	ainvil.AddFileSource(parserSource{Parser{Name: "sdk-only", Sniff: func([]byte) bool { return false }, Parse: ParseBeeFile}})
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "ainvil-parser-a", `{"protocol":1,"name":"bee","extensions":[".taken"]}`)
+	writePlugin(t, dir, "ainvil-parser-b", `{"protocol":1,"name":"sdk-only","extensions":[".taken"]}`)
+
+	var loaded []*Plugin
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("LoadPlugins panicked: %v", r)
+			}
+		}()
+		loaded = LoadPlugins([]string{dir})
+	}()
+	for _, p := range loaded {
+		if filepath.Dir(p.Path) == dir {
+			t.Errorf("plugin %s loaded under a taken name", p.Path)
+		}
+	}
+	if p, _ := LookupParser("bee"); p.Extensions != nil {
+		t.Errorf("the built-in bee parser was replaced: %+v", p)
+	}
+
+	if err := AddParser(Parser{Name: "BEE", Parse: ParseBeeFile}); err == nil {
+		t.Error("AddParser accepted a taken name")
+	}
+}
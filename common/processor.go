@@ -22,87 +22,288 @@ THE SOFTWARE.
 package common
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
+	"sync"
 	"time"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
 )
 
 type ParserFunc func(path string) (*PendantExport, error)
 
-func ProcessTextExports(sourceDir, outDir, sourceType string, parser ParserFunc) error {
+// ProcessTextExports imports the .txt files below sourceDir, or whatever
+// opts.Include selects instead, with a single parser.
+func ProcessTextExports(ctx context.Context, sourceDir, outDir, sourceType string, parser ParserFunc, opts ImportOptions) error {
+	p := Parser{Name: sourceType, Parse: parser}
+	return importSources(ctx, sourceDir, outDir, opts, []string{"*.txt"}, func(string) (Parser, error) {
+		return p, nil
+	})
+}
+
+// ImportMixedExports hands every file below sourceDir to the registered
+// parser whose Sniff func recognizes it. Files no parser recognizes are
+// reported and skipped.
+func ImportMixedExports(ctx context.Context, sourceDir, outDir string, opts ImportOptions) error {
+	return importSources(ctx, sourceDir, outDir, opts, nil, DetectParser)
+}
+
+// importSources collects the files below sourceDir, including those inside
+// archives, and processes them.
+func importSources(ctx context.Context, sourceDir, outDir string, opts ImportOptions, defaultInclude []string, resolve func(path string) (Parser, error)) error {
 	if sourceDir == "" {
 		return fmt.Errorf("--source is required")
 	}
 
-	files, err := os.ReadDir(sourceDir)
+	if opts.Watch {
+		return watchSources(ctx, sourceDir, outDir, opts, defaultInclude, resolve)
+	}
+
+	files, cleanup, err := collectSources(sourceDir, opts, defaultInclude, nil)
 	if err != nil {
 		return fmt.Errorf("error reading source directory: %w", err)
 	}
+	defer cleanup()
+
+	_, err = processFiles(ctx, files, outDir, opts, resolve)
+	return err
+}
+
+// TimeParseError reports an imported file whose start or end time could not
+// be understood. Such files are still saved, under the undated folder.
+type TimeParseError struct {
+	File       string
+	SourceType string
+	Reason     string
+}
+
+func (e TimeParseError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.File, e.SourceType, e.Reason)
+}
+
+// fileResult is the outcome of importing one file.
+type fileResult struct {
+	name    string
+	entry   PlanEntry
+	err     error // parse or save error, entry is then a reject
+	saveErr bool
+	timeErr string
+}
 
-	totalSaved := 0
-	for _, entry := range files {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".txt") {
-			continue
+// processFiles parses every file with the parser chosen by resolve and saves
+// the result under outDir, using opts.Workers goroutines. Results are
+// reported in the order of files regardless of which worker finishes first.
+// When ctx is cancelled no new files are started, files already in flight
+// are finished and reported, and ctx's error is returned. The plan entries
+// of the files that were processed are returned in the same order.
+func processFiles(ctx context.Context, files []sourceFile, outDir string, opts ImportOptions, resolve func(path string) (Parser, error)) ([]PlanEntry, error) {
+	w, err := NewExportWriter(outDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([]chan fileResult, len(files))
+	for i := range results {
+		results[i] = make(chan fileResult, 1)
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
-		inputPath := filepath.Join(sourceDir, entry.Name())
-		absInputPath, _ := filepath.Abs(inputPath)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] <- processFile(ctx, w, files[i], resolve)
+			}
+		}()
+	}
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
 
-		export, err := parser(inputPath)
-		if err != nil {
-			fmt.Printf("Skipping %s: %v\n", entry.Name(), err)
-			continue
+	var timeErrors []TimeParseError
+	var entries []PlanEntry
+	processed := 0
+	for i := range results {
+		r, ok := nextResult(results[i], allDone)
+		if !ok {
+			break
 		}
+		processed++
 
-		// Fill standard fields
-		export.ID = strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
-		export.SourceType = sourceType
-		export.ExportDate = time.Now().UTC().Format(time.RFC3339)
-		export.ExportVersion = GetVersion()
-		export.SourceFile = absInputPath
-
-		// Write it
-		if err := saveExport(outDir, export); err != nil {
-			fmt.Printf("Error saving %s: %v\n", entry.Name(), err)
-		} else {
-			fmt.Printf("Saved %s\n", entry.Name())
-			totalSaved++
+		w.Record(r.entry)
+		entries = append(entries, r.entry)
+		if !opts.DryRun {
+			switch {
+			case r.saveErr:
+				fmt.Printf("Error saving %s: %v\n", r.name, r.err)
+			case r.err != nil:
+				fmt.Printf("Skipping %s: %v\n", r.name, r.err)
+			default:
+				printSaved(r.name, r.entry)
+			}
+		}
+		if r.timeErr != "" {
+			timeErrors = append(timeErrors, TimeParseError{
+				File:       r.entry.Source,
+				SourceType: r.entry.SourceType,
+				Reason:     r.timeErr,
+			})
 		}
 	}
 
-	fmt.Printf("Done. %d memories saved.\n", totalSaved)
-	return nil
+	if err := w.Finish(); err != nil {
+		return entries, err
+	}
+	reportTimeErrors(outDir, timeErrors)
+
+	if processed < len(files) {
+		return entries, fmt.Errorf("interrupted after %d of %d files: %w", processed, len(files), ctx.Err())
+	}
+	return entries, nil
 }
 
-func saveExport(outRoot string, export *PendantExport) error {
-	t, err := time.Parse(time.RFC3339, export.StartTime)
+// nextResult waits for the result in ch. It gives up once all workers have
+// exited without producing one, which happens to files never started
+// because the run was cancelled.
+func nextResult(ch chan fileResult, allDone chan struct{}) (fileResult, bool) {
+	select {
+	case r := <-ch:
+		return r, true
+	case <-allDone:
+		select {
+		case r := <-ch:
+			return r, true
+		default:
+			return fileResult{}, false
+		}
+	}
+}
+
+// processFile parses and saves a single file.
+func processFile(ctx context.Context, w *ExportWriter, src sourceFile, resolve func(path string) (Parser, error)) fileResult {
+	name := src.label()
+	if src.Err != nil {
+		return fileResult{name: name, entry: rejectEntry(src.Name, "", src.Err), err: src.Err}
+	}
+
+	checksum, err := fileChecksum(src.Path)
+	if err != nil {
+		return fileResult{name: name, entry: rejectEntry(src.Name, "", err), err: err}
+	}
+	if entry, ok := w.unchangedSource(src.Name, checksum); ok {
+		return fileResult{name: name, entry: entry}
+	}
+
+	parser, err := resolve(src.Path)
 	if err != nil {
-		t = time.Now().UTC() // fallback
+		return fileResult{name: name, entry: rejectEntry(src.Name, "", err), err: err}
+	}
+
+	export, err := parser.parse(ctx, src.Path)
+	if err != nil {
+		return fileResult{name: name, entry: rejectEntry(src.Name, parser.Name, err), err: err}
+	}
+
+	fillStandardFields(export, parser.Name, src.Name)
+
+	// Write it
+	entry, err := w.write(src.Name, export)
+	if err == nil && entry.Action != ActionSkip {
+		w.recordSource(src.Name, checksum, export.SourceType, entry.Target)
+	}
+	return fileResult{
+		name:    name,
+		entry:   entry,
+		err:     err,
+		saveErr: err != nil,
+		timeErr: export.TimeError,
 	}
+}
+
+// fillStandardFields sets the fields every parsed file export carries.
+func fillStandardFields(export *PendantExport, sourceType, sourceFile string) {
+	export.SourceType = sourceType
+	export.ID = ContentID(export)
+	export.ExportDate = time.Now().UTC().Format(time.RFC3339)
+	export.ExportVersion = GetVersion()
+	export.SourceFile = sourceFile
+}
 
-	outDir := filepath.Join(
-		outRoot,
-		fmt.Sprintf("%04d", t.Year()),
-		fmt.Sprintf("%02d", t.Month()),
-		fmt.Sprintf("%02d", t.Day()),
-	)
+// printSaved reports the outcome of a non dry-run save.
+func printSaved(name string, entry PlanEntry) {
+	switch entry.Action {
+	case ActionIdentical:
+		fmt.Printf("Unchanged %s\n", name)
+	case ActionSkip:
+		fmt.Printf("Exists, skipped %s\n", name)
+	case ActionKeepBoth:
+		fmt.Printf("Saved %s as %s\n", name, filepath.Base(entry.Target))
+	default:
+		fmt.Printf("Saved %s\n", name)
+	}
+}
 
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		return fmt.Errorf("creating output dir: %w", err)
+func reportTimeErrors(outDir string, errs []TimeParseError) {
+	if len(errs) == 0 {
+		return
+	}
+	fmt.Printf("\n%d file(s) had dates that could not be parsed and were saved under %s:\n",
+		len(errs), filepath.Join(outDir, undatedDir))
+	for _, e := range errs {
+		fmt.Println("  " + e.Error())
 	}
+}
 
-	outPath := filepath.Join(outDir, export.ID+".json")
+// undatedDir holds exports whose start time could not be parsed.
+const undatedDir = ainvil.UndatedDir
 
-	f, err := os.Create(outPath)
+func exportPath(outRoot string, export *PendantExport) string {
+	return ainvil.Archive{Root: outRoot}.Path(export)
+}
+
+func saveExport(outRoot string, export *PendantExport) error {
+	flagUnparsedTimes(export)
+	if export.TimeError != "" {
+		fmt.Printf("Warning: %s %s has %s, saving as undated\n", export.SourceType, export.ID, export.TimeError)
+	}
+	return writeExport(exportPath(outRoot, export), export)
+}
+
+// writeExport writes export as indented JSON to outPath, atomically.
+func writeExport(outPath string, export *PendantExport) error {
+	data, err := ainvil.Encode(export)
 	if err != nil {
-		return fmt.Errorf("creating output file: %w", err)
+		return fmt.Errorf("encoding export: %w", err)
 	}
-	defer f.Close()
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	return enc.Encode(export)
+	if err := writeFileAtomic(outPath, data, 0644); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeBeeFixtures writes n distinct Bee exports into dir.
+func writeBeeFixtures(t testing.TB, dir string, n int) []string {
+	t.Helper()
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("bee_%04d.txt", i))
+		body := fmt.Sprintf(`Start Time: Jun %d, 2025 at %d:15 PM
+End Time: Jun %d, 2025 at %d:45 PM
+Device Type: Bee
+Short Summary: Conversation %d
+
+Summary:
+A short chat, number %d.
+
+Transcription:
+Speaker 1: Hello, this is conversation %d.
+Speaker 2: Nice to hear from you.
+`, i%28+1, i%11+1, i%28+1, i%11+1, i, i, i)
+		if err := os.WriteFile(paths[i], []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// silenceStdout discards the processor's progress output for the rest of
+// the test.
+func silenceStdout(t testing.TB) {
+	t.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+func readPlan(t testing.TB, path string) Plan {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func beeResolver(string) (Parser, error) {
+	return Parser{Name: "bee", Parse: ParseBeeFile}, nil
+}
+
+func TestProcessFilesParallelPlanIsOrdered(t *testing.T) {
+	silenceStdout(t)
+	paths := writeBeeFixtures(t, t.TempDir(), 50)
+
+	var plans [][]PlanEntry
+	for _, workers := range []int{1, 8} {
+		out := t.TempDir()
+		planPath := filepath.Join(out, "plan.json")
+		opts := ImportOptions{DryRun: true, PlanOutput: planPath, Workers: workers}
+		if _, err := processFiles(context.Background(), localSources(paths), out, opts, beeResolver); err != nil {
+			t.Fatal(err)
+		}
+
+		plan := readPlan(t, planPath)
+		for i := range plan.Entries {
+			plan.Entries[i].Target = filepath.Base(plan.Entries[i].Target)
+		}
+		plans = append(plans, plan.Entries)
+	}
+
+	if !reflect.DeepEqual(plans[0], plans[1]) {
+		t.Fatal("parallel run produced a different plan than the sequential one")
+	}
+	for i, e := range plans[1] {
+		if e.Source != paths[i] {
+			t.Fatalf("entry %d is %s, want %s", i, e.Source, paths[i])
+		}
+	}
+}
+
+func TestProcessFilesCancelled(t *testing.T) {
+	silenceStdout(t)
+	paths := writeBeeFixtures(t, t.TempDir(), 20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := processFiles(ctx, localSources(paths), t.TempDir(), ImportOptions{Workers: 4}, beeResolver)
+	if err == nil {
+		t.Fatal("expected an interrupted error")
+	}
+}
+
+// BenchmarkProcessFiles compares one worker against a pool. Writes are
+// fsynced, so the pool helps even on a single CPU.
+func BenchmarkProcessFiles(b *testing.B) {
+	silenceStdout(b)
+	paths := writeBeeFixtures(b, b.TempDir(), 200)
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				out := b.TempDir()
+				if _, err := processFiles(context.Background(), localSources(paths), out, ImportOptions{Workers: workers}, beeResolver); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
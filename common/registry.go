@@ -0,0 +1,163 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
+)
+
+// Parser describes a file based source format. Sniff inspects the first
+// bytes of a file and reports whether it looks like this format, Parse turns
+// the file into a PendantExport. Extensions, if set, limits detection to
+// files with those extensions. ParseContext, if set, is used by the import
+// commands instead of Parse, so that cancelling the import stops it.
+type Parser struct {
+	Name         string
+	Extensions   []string
+	Sniff        func(head []byte) bool
+	Parse        ParserFunc
+	ParseContext func(ctx context.Context, path string) (*PendantExport, error)
+}
+
+// parse runs ParseContext with ctx if the parser has one, and Parse
+// otherwise.
+func (p Parser) parse(ctx context.Context, path string) (*PendantExport, error) {
+	if p.ParseContext != nil {
+		return p.ParseContext(ctx, path)
+	}
+	return p.Parse(path)
+}
+
+// accepts reports whether path has one of p's extensions.
+func (p Parser) accepts(path string) bool {
+	return ainvil.HasExtension(path, p.Extensions)
+}
+
+var parsers []Parser
+
+// RegisterParser adds a parser to the registry. Parsers are tried in the
+// order they were registered when detecting the format of a file. Parsers
+// with a Sniff func are also registered as SDK file sources. It panics if
+// the parser cannot be added; see AddParser.
+func RegisterParser(p Parser) {
+	if err := AddParser(p); err != nil {
+		panic("common: " + err.Error())
+	}
+}
+
+// AddParser is RegisterParser for parsers that are not known at compile
+// time, such as plugins. It returns an error if p has no name or parse
+// func, or if a parser or SDK file source already uses its name.
+func AddParser(p Parser) error {
+	if p.Name == "" || p.Parse == nil {
+		return errors.New("a parser needs a name and a parse func")
+	}
+	if _, ok := LookupParser(p.Name); ok {
+		return fmt.Errorf("parser %q is already registered", p.Name)
+	}
+	if p.Sniff != nil {
+		if err := ainvil.AddFileSource(parserSource{p}); err != nil {
+			return err
+		}
+	}
+	parsers = append(parsers, p)
+	return nil
+}
+
+// parserSource exposes a Parser as an ainvil.FileSource.
+type parserSource struct {
+	p Parser
+}
+
+func (s parserSource) Name() string           { return s.p.Name }
+func (s parserSource) Extensions() []string   { return s.p.Extensions }
+func (s parserSource) Sniff(head []byte) bool { return s.p.Sniff(head) }
+
+func (s parserSource) Parse(path string) (*ainvil.Record, error) {
+	export, err := s.p.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	// Record the absolute path, as the import commands do.
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	fillStandardFields(export, s.p.Name, abs)
+	return export, nil
+}
+
+// LookupParser returns the registered parser with the given name.
+func LookupParser(name string) (Parser, bool) {
+	for _, p := range parsers {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Parser{}, false
+}
+
+// RegisteredParsers returns the names of all registered parsers.
+func RegisteredParsers() []string {
+	names := make([]string, 0, len(parsers))
+	for _, p := range parsers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// DetectParser reads the first bytes of path and returns the first registered
+// parser whose Sniff func accepts them.
+func DetectParser(path string) (Parser, error) {
+	head, err := ainvil.ReadHead(path)
+	if err != nil {
+		return Parser{}, err
+	}
+
+	for _, p := range parsers {
+		if p.Sniff != nil && p.accepts(path) && p.Sniff(head) {
+			return p, nil
+		}
+	}
+	return Parser{}, fmt.Errorf("unrecognized format")
+}
+
+// sniffLines calls match for every trimmed, non-empty line in head and
+// reports whether any call returned true.
+func sniffLines(head []byte, match func(line string) bool) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(head))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && match(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
+)
+
+func TestSniffers(t *testing.T) {
+	tests := []struct {
+		name  string
+		head  string
+		sniff func([]byte) bool
+		want  bool
+	}{
+		{"bee headers", "Start Time: Jun 3, 2025 at 7:15 PM\nDevice Type: Bee\n", sniffBee, true},
+		{"bee start time only", "Start Time: Jun 3, 2025 at 7:15 PM\n", sniffBee, false},
+		{"bee on omi", "Memory from Jun 4, 2025 at 9:00 AM to 9:30 AM\n", sniffBee, false},
+		{"omi memory line", "Memory from Jun 4, 2025 at 9:00 AM to 9:30 AM\n\nTitle: x\n", sniffOmi, true},
+		{"omi indented", "  Memory from Jun 4, 2025 at 9:00 AM\n", sniffOmi, true},
+		{"omi on bee", "Start Time: Jun 3, 2025\nTranscription:\n", sniffOmi, false},
+		{"chatgpt header", "Recorder: ChatGPT\nTimezone: UTC\n", sniffChatGPT, true},
+		{"chatgpt line", "[12] Speaker 2: Hi.\n", sniffChatGPT, true},
+		{"chatgpt on prose", "Start here and end there\n", sniffChatGPT, false},
+	}
+	for _, tt := range tests {
+		if got := tt.sniff([]byte(tt.head)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectParserMixedFolder(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"bee.txt", "bee"},
+		{"omi.txt", "omi"},
+		{"omi_late.txt", "omi"},
+		{"chatgpt.txt", "chatgpt"},
+		{"notes.txt", ""},
+	}
+	for _, tt := range tests {
+		p, err := DetectParser(filepath.Join("testdata", "mixed", tt.file))
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: detected %q, want unrecognized", tt.file, p.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+		} else if p.Name != tt.want {
+			t.Errorf("%s: detected %q, want %q", tt.file, p.Name, tt.want)
+		}
+	}
+
+	if _, err := DetectParser(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file: expected an error")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DetectParser(empty); err == nil {
+		t.Error("empty file: expected unrecognized format")
+	}
+}
+
+// TestFileSourceMatchesImport checks that the SDK's file sources describe a
+// file the same way the import commands do.
+func TestFileSourceMatchesImport(t *testing.T) {
+	silenceStdout(t)
+	rel := filepath.Join("testdata", "mixed", "bee.txt")
+	abs, err := filepath.Abs(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := ainvil.DetectFileSource(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := src.Parse(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	entries, err := processFiles(context.Background(), localSources([]string{rel}), out, ImportOptions{Workers: 1}, DetectParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ainvil.Archive{Root: out}.Read(entries[0].Target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.SourceFile != abs || imported.SourceFile != abs {
+		t.Errorf("SourceFile: SDK %q, import %q, want %q", r.SourceFile, imported.SourceFile, abs)
+	}
+	if r.ID != imported.ID || r.SourceType != imported.SourceType {
+		t.Errorf("SDK gave %s/%s, import %s/%s", r.SourceType, r.ID, imported.SourceType, imported.ID)
+	}
+}
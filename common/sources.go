@@ -0,0 +1,108 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/sottey/ainvil/pkg/ainvil"
+)
+
+// defaultLimitlessURL is the lifelogs endpoint used when the SDK is asked
+// for a Limitless source without a base URL.
+const defaultLimitlessURL = "https://api.limitless.ai/v1/lifelogs"
+
+func init() {
+	ainvil.RegisterSource("omi", func(token, baseURL string) ainvil.Source {
+		return omiSource{NewOmiClient(token, baseURL)}
+	})
+	ainvil.RegisterSource("limitless", func(token, baseURL string) ainvil.Source {
+		if baseURL == "" {
+			baseURL = defaultLimitlessURL
+		}
+		return limitlessSource{NewLimitlessClient(token, baseURL, 0)}
+	})
+}
+
+// omiSource exposes the Omi conversations API as an ainvil.Source.
+type omiSource struct {
+	client *OmiClient
+}
+
+func (omiSource) Name() string { return "omi" }
+
+func (s omiSource) Records(ctx context.Context, start, end time.Time) iter.Seq2[*ainvil.Record, error] {
+	return func(yield func(*ainvil.Record, error) bool) {
+		for conv, err := range s.client.Stream(ctx, start, end) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(conv.ToPendantExport(), nil) {
+				return
+			}
+		}
+	}
+}
+
+// limitlessSource exposes the Limitless lifelogs API as an ainvil.Source.
+type limitlessSource struct {
+	client *LimitlessClient
+}
+
+func (limitlessSource) Name() string { return "limitless" }
+
+func (s limitlessSource) Records(ctx context.Context, start, end time.Time) iter.Seq2[*ainvil.Record, error] {
+	return func(yield func(*ainvil.Record, error) bool) {
+		params, err := LimitlessOptions{}.query()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if !start.IsZero() {
+			params.Set("start", limitlessTime(start.Format(time.RFC3339)))
+		}
+		if !end.IsZero() {
+			params.Set("end", limitlessTime(end.Format(time.RFC3339)))
+		}
+
+		for raw, err := range s.client.Lifelogs(ctx, params) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			var item LimitlessLifelog
+			if err := json.Unmarshal(raw, &item); err != nil {
+				yield(nil, fmt.Errorf("malformed lifelog: %w", err))
+				return
+			}
+			item.Raw = raw
+			if !yield(item.ToPendantExport(), nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Speaker-prefixed transcript lines in the shapes Bee and Omi write them:
+//
+//	Speaker 1: text
+//	[00:01:23] Speaker 1: text   (also (..) or a bare timestamp)
+//	Speaker 1 (00:01:23): text   (also [..])
+//
+// A name before a colon is only taken as a speaker when it is a generic
+// "Speaker N" label, the wearer, carries an offset, or starts more than one
+// line of the transcript. That keeps "We meet at 9:00" or "Note: buy milk"
+// in the utterance they belong to.
+var (
+	leadingOffsetRE  = regexp.MustCompile(`^[\[(]?(\d{1,2}(?::\d{2}){1,2}(?:\.\d+)?)[\])]?\s+(.+)$`)
+	speakerLineRE    = regexp.MustCompile(`^([\p{L}][\p{L}\p{N} .'_-]{0,39}?)\s*(?:[\[(](\d{1,2}(?::\d{2}){1,2}(?:\.\d+)?)[\])])?:(?:\s+(.*))?$`)
+	genericSpeakerRE = regexp.MustCompile(`^(?i:speaker)[ _]?\d+$`)
+	userSpeakerNames = map[string]bool{"you": true, "me": true, "user": true}
+)
+
+// speakerLine is a transcript line split into its offset, speaker and text.
+// speaker is empty when the line has no speaker-shaped prefix.
+type speakerLine struct {
+	line    string
+	offset  string
+	speaker string
+	text    string
+}
+
+func parseSpeakerLine(line string) speakerLine {
+	sl := speakerLine{line: line}
+	rest := line
+	if m := leadingOffsetRE.FindStringSubmatch(line); m != nil {
+		sl.offset, rest = m[1], m[2]
+	}
+
+	m := speakerLineRE.FindStringSubmatch(rest)
+	if m == nil || strings.Count(m[1], " ") > 3 {
+		return sl
+	}
+	if m[2] != "" {
+		sl.offset = m[2]
+	}
+	sl.speaker = strings.TrimSpace(m[1])
+	sl.text = strings.TrimSpace(m[3])
+	return sl
+}
+
+// splitUtterances turns speaker-prefixed transcript lines into one blockquote
+// per utterance. Lines without a speaker prefix continue the previous
+// utterance. When a line carries an offset, StartOffsetMs is set and, if
+// start is an RFC3339 time, StartTime too.
+func splitUtterances(lines []string, start string) []ContentEntry {
+	base, baseErr := time.Parse(time.RFC3339, start)
+
+	var parsed []speakerLine
+	seen := make(map[string]int)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sl := parseSpeakerLine(line)
+		if sl.speaker != "" {
+			seen[sl.speaker]++
+		}
+		parsed = append(parsed, sl)
+	}
+
+	var entries []ContentEntry
+	for _, sl := range parsed {
+		if !knownSpeaker(sl, seen) {
+			if len(entries) > 0 && sl.offset == "" {
+				entries[len(entries)-1].Content += "\n" + sl.line
+			} else {
+				entries = append(entries, ContentEntry{Type: "blockquote", Content: sl.line})
+			}
+			continue
+		}
+
+		entry := ContentEntry{
+			Type:              "blockquote",
+			Content:           sl.text,
+			SpeakerName:       sl.speaker,
+			SpeakerIdentifier: speakerIdentifier(sl.speaker),
+		}
+		if ms, ok := parseOffsetMs(sl.offset); ok {
+			entry.StartOffsetMs = ms
+			if baseErr == nil {
+				entry.StartTime = base.Add(time.Duration(ms) * time.Millisecond).Format(time.RFC3339)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// knownSpeaker reports whether sl starts a new utterance: its speaker is a
+// "Speaker N" label or the wearer, it carries an offset, or the same name
+// starts other lines too.
+func knownSpeaker(sl speakerLine, seen map[string]int) bool {
+	switch {
+	case sl.speaker == "":
+		return false
+	case sl.offset != "", genericSpeakerRE.MatchString(sl.speaker), speakerIdentifier(sl.speaker) == "user":
+		return true
+	default:
+		return seen[sl.speaker] > 1
+	}
+}
+
+// speakerIdentifier returns "user" for the wearer, as Limitless does, and a
+// lower-case slug of the name for everyone else.
+func speakerIdentifier(name string) string {
+	slug := strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if userSpeakerNames[slug] {
+		return "user"
+	}
+	return slug
+}
+
+// parseOffsetMs parses mm:ss or hh:mm:ss, optionally with fractional
+// seconds, into milliseconds.
+func parseOffsetMs(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	parts := strings.Split(s, ":")
+	secs, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0, false
+	}
+	total := secs
+	mult := 60.0
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, false
+		}
+		total += float64(n) * mult
+		mult *= 60
+	}
+	return int(total * 1000), true
+}
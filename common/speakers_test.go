@@ -0,0 +1,121 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type utterance struct {
+	speaker  string
+	id       string
+	content  string
+	offsetMs int
+}
+
+func checkUtterances(t *testing.T, got []ContentEntry, want []utterance) {
+	t.Helper()
+	if len(got) != len(want) {
+		for _, e := range got {
+			t.Logf("%q: %q", e.SpeakerName, e.Content)
+		}
+		t.Fatalf("got %d utterances, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		e := got[i]
+		if e.Type != "blockquote" || e.SpeakerName != w.speaker || e.SpeakerIdentifier != w.id ||
+			e.Content != w.content || e.StartOffsetMs != w.offsetMs {
+			t.Errorf("utterance %d: got %s %q (%q) %q @%d, want blockquote %q (%q) %q @%d", i,
+				e.Type, e.SpeakerName, e.SpeakerIdentifier, e.Content, e.StartOffsetMs,
+				w.speaker, w.id, w.content, w.offsetMs)
+		}
+	}
+}
+
+func TestParseBeeFileUtterances(t *testing.T) {
+	export, err := ParseBeeFile(filepath.Join("testdata", "speakers", "bee.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUtterances(t, export.Contents[2:], []utterance{
+		{"Speaker 1", "speaker_1", "When is the review?", 0},
+		{"Speaker 2", "speaker_2", "We meet at 9:00 AM tomorrow.\nTime is 10:30 today, so we have a while.", 0},
+		{"Speaker 1", "speaker_1", "OK.\nNote: buy milk", 0},
+		{"You", "user", "And bread.", 0},
+	})
+}
+
+func TestParseOmiFileUtterances(t *testing.T) {
+	export, err := ParseOmiFile(filepath.Join("testdata", "speakers", "omi.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUtterances(t, export.Contents[2:], []utterance{
+		{"Alice", "alice", "Morning all.", 5000},
+		{"Bob", "bob", "Morning. Agenda: just the release.", 12000},
+		{"Alice", "alice", "Release is at 3:00 PM.", 0},
+		{"Bob", "bob", "Fine.\nReminder: update the changelog", 0},
+	})
+}
+
+func TestSplitUtterances(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []utterance
+	}{
+		{
+			name:  "clock in first line",
+			lines: []string{"We meet at 9:00 AM tomorrow", "Speaker 1: Sure."},
+			want: []utterance{
+				{"", "", "We meet at 9:00 AM tomorrow", 0},
+				{"Speaker 1", "speaker_1", "Sure.", 0},
+			},
+		},
+		{
+			name:  "single labelled aside",
+			lines: []string{"Speaker 0: Shopping list.", "Note: buy milk"},
+			want: []utterance{
+				{"Speaker 0", "speaker_0", "Shopping list.\nNote: buy milk", 0},
+			},
+		},
+		{
+			name:  "diarized label",
+			lines: []string{"SPEAKER_01: Hello."},
+			want:  []utterance{{"SPEAKER_01", "speaker_01", "Hello.", 0}},
+		},
+		{
+			name:  "leading offset",
+			lines: []string{"[01:02] Carol: Hi.", "(1:00:00) Carol: Still here."},
+			want: []utterance{
+				{"Carol", "carol", "Hi.", 62000},
+				{"Carol", "carol", "Still here.", 3600000},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkUtterances(t, splitUtterances(tt.lines, ""), tt.want)
+		})
+	}
+}
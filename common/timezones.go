@@ -0,0 +1,129 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Timestamps that carry no offset (Bee's "Jun 3, 2025 at 7:15 PM", Omi's
+// "Memory from ..." line, ChatGPT files without a Timezone header) are read in
+// the zone configured for their source, falling back to the default zone.
+// Timestamps that do carry an offset are converted into that zone, so day
+// folders follow the wearer's local date rather than UTC. After --tz or
+// --source-tz changes, the next import parses the affected source files
+// again, even if they are unchanged, and ExportWriter moves exports whose
+// day folder or ID changed as a result, removing the copy at the old path.
+var (
+	defaultLocation = time.Local
+	sourceLocations = map[string]*time.Location{}
+)
+
+// ConfigureTimezones sets the default zone and per-source overrides given as
+// "source=Zone" pairs. An empty def keeps the system zone.
+func ConfigureTimezones(def string, overrides []string) error {
+	if def != "" {
+		loc, err := time.LoadLocation(def)
+		if err != nil {
+			return fmt.Errorf("invalid --tz: %w", err)
+		}
+		defaultLocation = loc
+	}
+
+	for _, o := range overrides {
+		source, name, ok := strings.Cut(o, "=")
+		if !ok {
+			return fmt.Errorf("invalid --source-tz %q, expected source=Zone", o)
+		}
+		loc, err := time.LoadLocation(strings.TrimSpace(name))
+		if err != nil {
+			return fmt.Errorf("invalid --source-tz %q: %w", o, err)
+		}
+		sourceLocations[strings.ToLower(strings.TrimSpace(source))] = loc
+	}
+	return nil
+}
+
+// SourceLocation returns the zone timestamps of the given source are read in.
+func SourceLocation(source string) *time.Location {
+	if loc, ok := sourceLocations[strings.ToLower(source)]; ok {
+		return loc
+	}
+	return defaultLocation
+}
+
+// NormalizeTime parses raw as RFC3339 or one of layouts and returns it as
+// RFC3339 in the source's zone. Layouts without an offset are interpreted in
+// that zone.
+func NormalizeTime(source, raw string, layouts ...string) (string, error) {
+	t, err := ParseSourceTime(source, raw, layouts...)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+// ParseSourceTime is NormalizeTime returning the time.Time.
+func ParseSourceTime(source, raw string, layouts ...string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+
+	loc := SourceLocation(source)
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", raw)
+}
+
+// normalizeOrRaw returns raw normalized into the source's zone, or raw
+// unchanged if it cannot be parsed.
+func normalizeOrRaw(source, raw string) string {
+	if t, err := NormalizeTime(source, raw); err == nil {
+		return t
+	}
+	return raw
+}
+
+// flagUnparsedTimes records on the export why its start or end time could
+// not be read, so such entries are filed as undated instead of silently
+// landing in today's folder.
+func flagUnparsedTimes(export *PendantExport) {
+	var problems []string
+	if _, err := time.Parse(time.RFC3339, export.StartTime); err != nil {
+		problems = append(problems, fmt.Sprintf("unparsed startTime %q", export.StartTime))
+	}
+	if export.EndTime != "" {
+		if _, err := time.Parse(time.RFC3339, export.EndTime); err != nil {
+			problems = append(problems, fmt.Sprintf("unparsed endTime %q", export.EndTime))
+		}
+	}
+	export.TimeError = strings.Join(problems, "; ")
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureTimezones(t *testing.T) {
+	pinTimezones(t, "America/New_York", "Bee = Europe/Berlin")
+	if got := SourceLocation("bee").String(); got != "Europe/Berlin" {
+		t.Errorf("bee: got %s, want Europe/Berlin", got)
+	}
+	if got := SourceLocation("BEE").String(); got != "Europe/Berlin" {
+		t.Errorf("BEE: got %s, want Europe/Berlin", got)
+	}
+	if got := SourceLocation("omi").String(); got != "America/New_York" {
+		t.Errorf("omi: got %s, want the default America/New_York", got)
+	}
+
+	// An empty default keeps the zone configured so far.
+	if err := ConfigureTimezones("", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := SourceLocation("omi").String(); got != "America/New_York" {
+		t.Errorf("after empty --tz: got %s, want America/New_York", got)
+	}
+
+	for _, tt := range []struct {
+		def       string
+		overrides []string
+	}{
+		{"Mars/Olympus_Mons", nil},
+		{"", []string{"bee"}},
+		{"", []string{"bee=Nowhere/Special"}},
+	} {
+		if err := ConfigureTimezones(tt.def, tt.overrides); err == nil {
+			t.Errorf("ConfigureTimezones(%q, %q): want an error", tt.def, tt.overrides)
+		}
+	}
+}
+
+func TestNormalizeTime(t *testing.T) {
+	pinTimezones(t, "America/Los_Angeles", "omi=UTC")
+	const beeLayout = "Jan 2, 2006 at 3:04 PM"
+
+	tests := []struct {
+		name    string
+		source  string
+		raw     string
+		layouts []string
+		want    string
+		wantErr bool
+	}{
+		{"layout read in default zone", "bee", "Jun 3, 2025 at 7:15 PM", []string{beeLayout}, "2025-06-03T19:15:00-07:00", false},
+		{"layout read in source zone", "omi", "Jun 3, 2025 at 7:15 PM", []string{beeLayout}, "2025-06-03T19:15:00Z", false},
+		{"utc converted", "limitless", "2025-06-04T02:15:00Z", nil, "2025-06-03T19:15:00-07:00", false},
+		{"offset converted", "chatgpt", "2025-06-04T05:15:00+03:00", nil, "2025-06-03T19:15:00-07:00", false},
+		{"offset converted to source zone", "omi", "2025-06-03T19:15:00-07:00", nil, "2025-06-04T02:15:00Z", false},
+		{"surrounding space", "bee", "  2025-06-04T02:15:00Z ", nil, "2025-06-03T19:15:00-07:00", false},
+		{"empty", "bee", "", []string{beeLayout}, "", true},
+		{"unrecognized", "bee", "yesterday", []string{beeLayout}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTime(tt.source, tt.raw, tt.layouts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := normalizeOrRaw("bee", "yesterday"); got != "yesterday" {
+		t.Errorf("normalizeOrRaw: got %q, want the raw value", got)
+	}
+}
+
+func TestFlagUnparsedTimes(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       string
+	}{
+		{"2025-06-03T19:15:00-07:00", "2025-06-03T19:45:00-07:00", ""},
+		{"2025-06-03T19:15:00-07:00", "", ""},
+		{"Jun 3", "2025-06-03T19:45:00-07:00", `unparsed startTime "Jun 3"`},
+		{"", "", `unparsed startTime ""`},
+		{"Jun 3", "later", `unparsed startTime "Jun 3"; unparsed endTime "later"`},
+	}
+	for _, tt := range tests {
+		export := &PendantExport{StartTime: tt.start, EndTime: tt.end, TimeError: "stale"}
+		flagUnparsedTimes(export)
+		if export.TimeError != tt.want {
+			t.Errorf("%q-%q: got %q, want %q", tt.start, tt.end, export.TimeError, tt.want)
+		}
+	}
+}
+
+// TestExportWriterMovesChangedDay checks that an export whose day folder
+// changes with the zone is moved, not duplicated.
+func TestExportWriterMovesChangedDay(t *testing.T) {
+	silenceStdout(t)
+	outDir := t.TempDir()
+
+	save := func(start string) PlanEntry {
+		t.Helper()
+		w, err := NewExportWriter(outDir, ImportOptions{KeepHistory: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := w.Save("api", &PendantExport{
+			ID:         "abc",
+			SourceType: "limitless",
+			StartTime:  start,
+			UpdatedAt:  start,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	utc := filepath.Join(outDir, "2025", "06", "04", "limitless_abc.json")
+	local := filepath.Join(outDir, "2025", "06", "03", "limitless_abc.json")
+
+	save("2025-06-04T02:15:00Z")
+	entry := save("2025-06-03T19:15:00-07:00")
+	if entry.Action != ActionCreate || entry.Target != local {
+		t.Fatalf("got %s -> %s, want create -> %s", entry.Action, entry.Target, local)
+	}
+	if !strings.Contains(entry.Reason, "moved from "+utc) {
+		t.Errorf("reason %q does not name the old path", entry.Reason)
+	}
+
+	if _, err := os.Stat(utc); !os.IsNotExist(err) {
+		t.Errorf("old copy still at %s (%v)", utc, err)
+	}
+	if _, err := os.Stat(local); err != nil {
+		t.Error(err)
+	}
+	history, _ := filepath.Glob(filepath.Join(outDir, stateDir, "history", "limitless", "abc", "*.json"))
+	if len(history) != 1 {
+		t.Errorf("got history %v, want the old copy", history)
+	}
+
+	m, err := OpenManifest(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 1 {
+		t.Errorf("got manifest entries %v, want one", m.Entries)
+	}
+	if _, ok := m.Entries["2025/06/03/limitless_abc.json"]; !ok {
+		t.Errorf("manifest is missing the new path: %v", m.Entries)
+	}
+}
+
+func TestImportAfterTimezoneChange(t *testing.T) {
+	for _, policy := range []OverwritePolicy{PolicyUpdateIfChanged, PolicyOverwrite} {
+		t.Run(string(policy), func(t *testing.T) {
+			silenceStdout(t)
+			src, out := t.TempDir(), t.TempDir()
+			data, err := os.ReadFile(filepath.Join("testdata", "mixed", "bee.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(src, "bee.txt"), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			importBee := func() PlanEntry {
+				t.Helper()
+				planPath := filepath.Join(t.TempDir(), "plan.json")
+				opts := ImportOptions{Policy: policy, PlanOutput: planPath}
+				if err := ProcessTextExports(context.Background(), src, out, "bee", ParseBeeFile, opts); err != nil {
+					t.Fatal(err)
+				}
+				plan := readPlan(t, planPath)
+				if len(plan.Entries) != 1 {
+					t.Fatalf("got plan %+v, want one entry", plan.Entries)
+				}
+				return plan.Entries[0]
+			}
+
+			pinTimezones(t, "Asia/Tokyo")
+			first := importBee()
+			if again := importBee(); again.Action != ActionIdentical && policy != PolicyOverwrite {
+				t.Fatalf("unchanged file and zone: got %s", again.Action)
+			}
+
+			// 7:15 PM in Los Angeles is a different instant, so the entry
+			// gets a new ID, and the copy read in Tokyo time must go.
+			pinTimezones(t, "America/Los_Angeles")
+			moved := importBee()
+			if moved.Action != ActionCreate || moved.ID == first.ID || moved.Reason != "moved from "+first.Target {
+				t.Fatalf("got %+v, want a create moved from %s", moved, first.Target)
+			}
+			if _, err := os.Stat(first.Target); !os.IsNotExist(err) {
+				t.Errorf("old copy still at %s (%v)", first.Target, err)
+			}
+
+			var export PendantExport
+			data, err = os.ReadFile(moved.Target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal(data, &export)
+			if export.StartTime != "2025-06-03T19:15:00-07:00" {
+				t.Errorf("got start %s", export.StartTime)
+			}
+
+			m, err := OpenManifest(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Entries) != 1 {
+				t.Errorf("got manifest entries %v, want one", m.Entries)
+			}
+			if again := importBee(); again.Action != ActionIdentical && policy != PolicyOverwrite {
+				t.Errorf("second import in the new zone: got %s", again.Action)
+			}
+		})
+	}
+}
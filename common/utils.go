@@ -23,11 +23,10 @@ package common
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -37,56 +36,6 @@ import (
 
 const currentVersion = "Ainvil 2.1.0"
 
-func FindMostRecentSavedDate(outRoot string) (string, error) {
-	var latest time.Time
-	foundAny := false
-
-	err := filepath.Walk(outRoot, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		if !strings.HasPrefix(filepath.Base(path), "limitless_") || !strings.HasSuffix(path, ".json") {
-			return nil
-		}
-
-		f, err := os.Open(path)
-		if err != nil {
-			return nil
-		}
-		defer f.Close()
-
-		var export PendantExport
-		if json.NewDecoder(f).Decode(&export) != nil {
-			return nil
-		}
-
-		t, err := time.Parse(time.RFC3339, export.StartTime)
-		if err != nil {
-			return nil
-		}
-
-		if !foundAny || t.After(latest) {
-			latest = t
-			foundAny = true
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	if !foundAny {
-		return "", fmt.Errorf("no existing limitless_*.json files found in %s", outRoot)
-	}
-
-	return latest.Format(time.RFC3339), nil
-}
-
 func ParseDateFlag(s string) (time.Time, error) {
 	if s == "" {
 		return time.Time{}, nil
@@ -112,8 +61,37 @@ func GenerateID() string {
 	return hex.EncodeToString(b)
 }
 
-func AddCommonFileFlags(cmd *cobra.Command) {
+// ContentID derives a stable ID from the source type, start time and
+// normalized transcript of an export, so importing the same recording twice
+// always yields the same ID. Exports without a transcript also hash their raw
+// payload to keep otherwise empty recordings apart.
+func ContentID(export *PendantExport) string {
+	start := export.StartTime
+	if t, err := time.Parse(time.RFC3339, start); err == nil {
+		start = t.UTC().Format(time.RFC3339)
+	}
+	transcript := strings.Join(strings.Fields(export.Transcript), " ")
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s", strings.ToLower(export.SourceType), start, transcript)
+	if transcript == "" {
+		h.Write(export.Raw)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
+
+// AddCommonFileFlags adds the flags of the file based importers. recursive
+// is the default of --recursive: the single-format importers only read the
+// top level of --source unless asked to, import descends by default.
+func AddCommonFileFlags(cmd *cobra.Command, recursive bool) {
 	cmd.Flags().String("source", "", "Directory containing input files")
+	cmd.Flags().Int("workers", runtime.NumCPU(), "Number of files to parse and write in parallel")
+	cmd.Flags().Bool("recursive", recursive, "Descend into subfolders of --source")
+	cmd.Flags().StringSlice("include", nil, "Only import files matching these glob patterns (default *.txt for single-format importers)")
+	cmd.Flags().StringSlice("exclude", nil, "Skip files and folders matching these glob patterns")
+	cmd.Flags().Bool("watch", false, "Keep running and import files as they are added or changed")
+	cmd.Flags().Duration("watch-debounce", defaultWatchDebounce, "How long a file must stay unchanged before --watch imports it")
+	cmd.Flags().String("watch-state", "", "Watch state file (default <out>/.ainvil/watch.json)")
 	viper.BindPFlags(cmd.Flags())
 }
 
@@ -125,6 +103,74 @@ func AddCommonAPIFlags(cmd *cobra.Command) {
 	viper.BindPFlags(cmd.Flags())
 }
 
+// AddImportFlags adds the flags shared by every import command. They are
+// read back with GetImportOptions rather than through viper, so they are not
+// bound.
+func AddImportFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("dry-run", false, "Show what would be created, overwritten or skipped without writing anything")
+	cmd.Flags().String("plan-output", "", "Write the plan of the run as JSON to this file")
+	cmd.Flags().String("overwrite-policy", string(PolicyUpdateIfChanged), "What to do with existing files: skip, overwrite, update-if-changed or keep-both")
+	cmd.Flags().Bool("keep-history", false, "Copy files into <out>/.ainvil/history before overwriting them")
+}
+
+// GetImportOptions reads the flags added by AddImportFlags.
+func GetImportOptions(cmd *cobra.Command) (ImportOptions, error) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	planOutput, _ := cmd.Flags().GetString("plan-output")
+	policyFlag, _ := cmd.Flags().GetString("overwrite-policy")
+	keepHistory, _ := cmd.Flags().GetBool("keep-history")
+	workers, _ := cmd.Flags().GetInt("workers")
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	watch, _ := cmd.Flags().GetBool("watch")
+	watchDebounce, _ := cmd.Flags().GetDuration("watch-debounce")
+	watchState, _ := cmd.Flags().GetString("watch-state")
+
+	policy, err := ParseOverwritePolicy(policyFlag)
+	if err != nil {
+		return ImportOptions{}, err
+	}
+	if err := ValidateGlobs(append(include, exclude...)); err != nil {
+		return ImportOptions{}, err
+	}
+	return ImportOptions{
+		DryRun:        dryRun,
+		PlanOutput:    planOutput,
+		Policy:        policy,
+		KeepHistory:   keepHistory,
+		Workers:       workers,
+		Recursive:     recursive,
+		Include:       include,
+		Exclude:       exclude,
+		Watch:         watch,
+		WatchDebounce: watchDebounce,
+		WatchState:    watchState,
+	}, nil
+}
+
+// AddPluginFlags adds the flags that control parser plugin discovery. Like
+// the import flags they are read directly and not bound to viper.
+func AddPluginFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("plugin-dir", nil, "Folder to search for ainvil-parser-* plugins before PATH (default <config dir>/ainvil/parsers)")
+	cmd.Flags().Bool("no-plugins", false, "Do not load parser plugins")
+}
+
+// GetPluginDirs returns the folders selected with --plugin-dir, or the
+// default plugin folder. ok is false when --no-plugins is set.
+func GetPluginDirs(cmd *cobra.Command) (dirs []string, ok bool) {
+	if off, _ := cmd.Flags().GetBool("no-plugins"); off {
+		return nil, false
+	}
+	dirs, _ = cmd.Flags().GetStringSlice("plugin-dir")
+	if len(dirs) == 0 {
+		if dir := DefaultPluginDir(); dir != "" {
+			dirs = []string{dir}
+		}
+	}
+	return dirs, true
+}
+
 func AddCommonServeFlags(cmd *cobra.Command) {
 	cmd.Flags().Int("port", 8080, "Port to serve on")
 	viper.BindPFlags(cmd.Flags())
@@ -0,0 +1,308 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// stateDir is the hidden folder in the output root where ainvil keeps its
+// own bookkeeping.
+const stateDir = ".ainvil"
+
+// defaultWatchDebounce is used when ImportOptions.WatchDebounce is not set.
+const defaultWatchDebounce = 2 * time.Second
+
+// WatchState is the state file of a watch. It records the size and
+// modification time of every source file a watch has imported, keyed by
+// absolute path, so a restarted watch only imports what changed while it
+// was stopped. Files that were rejected, or archives with a rejected
+// member, are recorded in Rejected and tried again once they change.
+type WatchState struct {
+	Files    map[string]FileStamp `json:"files"`
+	Rejected map[string]FileStamp `json:"rejected,omitempty"`
+}
+
+// FileStamp identifies one version of a file on disk.
+type FileStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func stampOf(info fs.FileInfo) FileStamp {
+	return FileStamp{Size: info.Size(), ModTime: info.ModTime().UTC()}
+}
+
+func (s FileStamp) equal(o FileStamp) bool {
+	return s.Size == o.Size && s.ModTime.Equal(o.ModTime)
+}
+
+func loadWatchState(path string) (*WatchState, error) {
+	state := &WatchState{Files: map[string]FileStamp{}, Rejected: map[string]FileStamp{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("reading watch state %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]FileStamp{}
+	}
+	if state.Rejected == nil {
+		state.Rejected = map[string]FileStamp{}
+	}
+	return state, nil
+}
+
+// sourceWatch is one running watch of a source directory.
+type sourceWatch struct {
+	sourceDir      string
+	outDir         string
+	opts           ImportOptions
+	defaultInclude []string
+	resolve        func(path string) (Parser, error)
+	debounce       time.Duration
+	statePath      string
+	state          *WatchState
+
+	// seen holds the stamp each not yet imported file had at the previous
+	// scan. A file is imported once it is unchanged between two scans, so
+	// files still being written or synced are left alone.
+	seen map[string]FileStamp
+}
+
+// watchSources imports the files below sourceDir, then keeps running until
+// ctx is cancelled, importing files as they are added or modified. Bursts of
+// file system events are debounced, and every batch goes through the same
+// pipeline as a one-off import.
+func watchSources(ctx context.Context, sourceDir, outDir string, opts ImportOptions, defaultInclude []string, resolve func(path string) (Parser, error)) error {
+	sw := &sourceWatch{
+		sourceDir:      sourceDir,
+		outDir:         outDir,
+		opts:           opts,
+		defaultInclude: defaultInclude,
+		resolve:        resolve,
+		debounce:       opts.WatchDebounce,
+		statePath:      opts.WatchState,
+		seen:           map[string]FileStamp{},
+	}
+	if sw.debounce <= 0 {
+		sw.debounce = defaultWatchDebounce
+	}
+	if sw.statePath == "" {
+		sw.statePath = filepath.Join(outDir, stateDir, "watch.json")
+	}
+
+	var err error
+	if sw.state, err = loadWatchState(sw.statePath); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := sw.addDirs(watcher, sourceDir); err != nil {
+		return err
+	}
+
+	fmt.Printf("Watching %s. Press Ctrl-C to stop.\n", sourceDir)
+
+	scan := time.NewTimer(0)
+	defer scan.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("Stopped watching.")
+			return nil
+
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) && sw.opts.Recursive {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := sw.addDirs(watcher, ev.Name); err != nil {
+						fmt.Println("Watch error:", err)
+					}
+				}
+			}
+			scan.Reset(sw.debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Println("Watch error:", err)
+
+		case <-scan.C:
+			pending, err := sw.scan(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				fmt.Println("Error:", err)
+				pending = true
+			}
+			if pending {
+				scan.Reset(sw.debounce)
+			}
+		}
+	}
+}
+
+// addDirs watches dir and, for recursive imports, the folders below it that
+// discovery would descend into.
+func (sw *sourceWatch) addDirs(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != sw.sourceDir {
+			rel, _ := filepath.Rel(sw.sourceDir, path)
+			if !sw.opts.Recursive || hiddenPath(d.Name()) || matchGlobs(sw.opts.Exclude, filepath.ToSlash(rel)) {
+				return filepath.SkipDir
+			}
+		}
+		return watcher.Add(path)
+	})
+}
+
+// scan imports the files that are new or changed since they were last
+// imported and have settled. It reports whether any file is still settling,
+// in which case another scan is due.
+func (sw *sourceWatch) scan(ctx context.Context) (pending bool, err error) {
+	present := map[string]bool{}
+	ready := map[string]FileStamp{}
+
+	files, cleanup, err := collectSources(sw.sourceDir, sw.opts, sw.defaultInclude, func(path string, info fs.FileInfo) bool {
+		abs, _ := filepath.Abs(path)
+		stamp := stampOf(info)
+		present[abs] = true
+
+		if done, ok := sw.state.Files[abs]; ok && done.equal(stamp) {
+			delete(sw.seen, abs)
+			return false
+		}
+		if bad, ok := sw.state.Rejected[abs]; ok && bad.equal(stamp) {
+			delete(sw.seen, abs)
+			return false
+		}
+		if prev, ok := sw.seen[abs]; !ok || !prev.equal(stamp) {
+			sw.seen[abs] = stamp
+			pending = true
+			return false
+		}
+		ready[abs] = stamp
+		return true
+	})
+	if err != nil {
+		return pending, err
+	}
+	defer cleanup()
+
+	// Forget files that have been removed from the source directory.
+	root, _ := filepath.Abs(sw.sourceDir)
+	pruned := false
+	for _, files := range []map[string]FileStamp{sw.state.Files, sw.state.Rejected} {
+		for path := range files {
+			if strings.HasPrefix(path, root+string(filepath.Separator)) && !present[path] {
+				delete(files, path)
+				pruned = true
+			}
+		}
+	}
+	for path := range sw.seen {
+		if !present[path] {
+			delete(sw.seen, path)
+		}
+	}
+
+	if len(ready) == 0 {
+		if pruned {
+			return pending, sw.save()
+		}
+		return pending, nil
+	}
+
+	var entries []PlanEntry
+	if len(files) > 0 {
+		if entries, err = processFiles(ctx, files, sw.outDir, sw.opts, sw.resolve); err != nil {
+			return pending, err
+		}
+	}
+
+	// A rejected file, or an archive with a rejected member, is kept
+	// apart so that it is tried again once it changes, and not on every
+	// scan until then.
+	rejected := map[string]bool{}
+	for _, e := range entries {
+		if e.Action == ActionReject {
+			name, _, _ := strings.Cut(e.Source, archiveSep)
+			rejected[name] = true
+		}
+	}
+	for path, stamp := range ready {
+		delete(sw.seen, path)
+		if rejected[path] {
+			sw.state.Rejected[path] = stamp
+			delete(sw.state.Files, path)
+		} else {
+			sw.state.Files[path] = stamp
+			delete(sw.state.Rejected, path)
+		}
+	}
+	return pending, sw.save()
+}
+
+// save writes the state file. Dry runs only keep the state in memory.
+func (sw *sourceWatch) save() error {
+	if sw.opts.DryRun {
+		return nil
+	}
+	data, err := json.MarshalIndent(sw.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sw.statePath), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(sw.statePath, data, 0644)
+}
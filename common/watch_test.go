@@ -0,0 +1,227 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testWatchDebounce = 20 * time.Millisecond
+
+// countingResolver resolves every file to the Bee parser, counting how
+// often each file name was parsed. Files named in reject fail to resolve.
+type countingResolver struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	reject map[string]bool
+}
+
+func newCountingResolver() *countingResolver {
+	return &countingResolver{calls: map[string]int{}, reject: map[string]bool{}}
+}
+
+func (r *countingResolver) resolve(path string) (Parser, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := filepath.Base(path)
+	r.calls[name]++
+	if r.reject[name] {
+		return Parser{}, errors.New("not ready")
+	}
+	return beeResolver(path)
+}
+
+func (r *countingResolver) count(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[name]
+}
+
+func (r *countingResolver) setReject(name string, reject bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reject[name] = reject
+}
+
+// startWatch runs watchSources until the test ends or the returned stop
+// func is called.
+func startWatch(t *testing.T, src, out string, resolve func(string) (Parser, error)) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watchSources(ctx, src, out, ImportOptions{WatchDebounce: testWatchDebounce, Workers: 1}, []string{"*.txt"}, resolve)
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("watch: %v", err)
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func exportCount(out string) int {
+	matches, _ := filepath.Glob(filepath.Join(out, "*", "*", "*", "bee_*.json"))
+	return len(matches)
+}
+
+// watchedFiles returns the imported and the rejected files in the watch
+// state of out, by base name.
+func watchedFiles(t *testing.T, out string) map[string]FileStamp {
+	t.Helper()
+	files, _ := watchState(t, out)
+	return files
+}
+
+func watchState(t *testing.T, out string) (files, rejected map[string]FileStamp) {
+	t.Helper()
+	state, err := loadWatchState(filepath.Join(out, stateDir, "watch.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, rejected = map[string]FileStamp{}, map[string]FileStamp{}
+	for path, stamp := range state.Files {
+		files[filepath.Base(path)] = stamp
+	}
+	for path, stamp := range state.Rejected {
+		rejected[filepath.Base(path)] = stamp
+	}
+	return files, rejected
+}
+
+func TestWatchImportsAndRemembers(t *testing.T) {
+	silenceStdout(t)
+	src, out := t.TempDir(), t.TempDir()
+	paths := writeBeeFixtures(t, src, 2)
+	first, second := filepath.Base(paths[0]), filepath.Base(paths[1])
+	os.Remove(paths[1])
+
+	r := newCountingResolver()
+	stop := startWatch(t, src, out, r.resolve)
+	waitFor(t, "the first file", func() bool { return exportCount(out) == 1 })
+	stop()
+
+	if _, ok := watchedFiles(t, out)[first]; !ok {
+		t.Fatalf("watch state is missing %s", first)
+	}
+
+	// A restarted watch imports only the file added since.
+	startWatch(t, src, out, r.resolve)
+	writeBeeFixtures(t, src, 2)
+	waitFor(t, "the second file", func() bool { return exportCount(out) == 2 })
+
+	if n := r.count(first); n != 1 {
+		t.Errorf("%s parsed %d times, want once", first, n)
+	}
+	if n := r.count(second); n != 1 {
+		t.Errorf("%s parsed %d times, want once", second, n)
+	}
+}
+
+func TestWatchRetriesRejectedFiles(t *testing.T) {
+	silenceStdout(t)
+	src, out := t.TempDir(), t.TempDir()
+	paths := writeBeeFixtures(t, src, 2)
+	bad, good := filepath.Base(paths[0]), filepath.Base(paths[1])
+	goodData, err := os.ReadFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(paths[1])
+
+	r := newCountingResolver()
+	r.setReject(bad, true)
+	stop := startWatch(t, src, out, r.resolve)
+	waitFor(t, "the rejected file to be recorded", func() bool {
+		_, rejected := watchState(t, out)
+		_, ok := rejected[bad]
+		return ok
+	})
+	if _, ok := watchedFiles(t, out)[bad]; ok {
+		t.Fatalf("rejected %s was recorded as imported", bad)
+	}
+
+	// Another file arriving makes the watch scan again, but the rejected
+	// file is unchanged and is left alone, also after a restart.
+	if err := os.WriteFile(paths[1], goodData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the other file", func() bool { _, ok := watchedFiles(t, out)[good]; return ok })
+	stop()
+	startWatch(t, src, out, r.resolve)
+	time.Sleep(5 * testWatchDebounce)
+	if n := r.count(bad); n != 1 {
+		t.Errorf("unchanged %s tried %d times, want once", bad, n)
+	}
+
+	// Once it changes it is tried again.
+	r.setReject(bad, false)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(paths[0], later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "both files", func() bool { return exportCount(out) == 2 })
+	waitFor(t, "the retried file in the watch state", func() bool {
+		files, rejected := watchState(t, out)
+		_, ok := files[bad]
+		return ok && len(rejected) == 0
+	})
+	if n := r.count(bad); n != 2 {
+		t.Errorf("%s tried %d times, want one retry", bad, n)
+	}
+}
+
+func TestWatchStatePrunesRemovedFiles(t *testing.T) {
+	silenceStdout(t)
+	src, out := t.TempDir(), t.TempDir()
+	paths := writeBeeFixtures(t, src, 1)
+
+	startWatch(t, src, out, beeResolver)
+	waitFor(t, "the file", func() bool { return len(watchedFiles(t, out)) == 1 })
+
+	os.Remove(paths[0])
+	waitFor(t, "the removed file to be forgotten", func() bool { return len(watchedFiles(t, out)) == 0 })
+}
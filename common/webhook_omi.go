@@ -0,0 +1,382 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OmiWebhook receives Omi "memory created" and "real-time transcript"
+// webhook calls and writes them straight into the output tree.
+//
+// Real-time segments are appended to an in-progress entry per session, saved
+// after every call. When the finished conversation arrives, it is saved under
+// its own ID and the in-progress entry of its session is removed. In-progress
+// entries are picked up again after a restart.
+//
+// Omi cannot send custom headers, so the shared secret is accepted either as
+// "Authorization: Bearer <secret>" or as a ?token=<secret> query parameter.
+type OmiWebhook struct {
+	OutDir string
+	Secret string
+
+	mu   sync.Mutex
+	live map[string]*omiLiveSession
+}
+
+// webhookLockWait is how long a webhook call waits for an import running
+// against the same output tree to finish.
+const webhookLockWait = 10 * time.Second
+
+const (
+	// liveIDPrefix starts the ID of every in-progress entry.
+	liveIDPrefix = "live-"
+	// liveUIDKey and liveSessionKey are the metadata keys an in-progress
+	// entry keeps its user and session in, so it can be restored.
+	liveUIDKey     = "omiUid"
+	liveSessionKey = "omiSessionId"
+	// liveMatchSlack is how long before a conversation's start its live
+	// session may have begun when the conversation carries no session ID.
+	liveMatchSlack = 2 * time.Minute
+)
+
+// webhookIDRE matches the session and conversation IDs the webhook accepts.
+// They become file names, so anything that could leave the output tree is
+// refused.
+var webhookIDRE = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type omiLiveSession struct {
+	uid       string
+	sessionID string
+	path      string
+	export    *PendantExport
+	start     time.Time
+}
+
+type omiTranscriptEvent struct {
+	SessionID string              `json:"session_id"`
+	Segments  []OmiTranscriptLine `json:"segments"`
+}
+
+// NewOmiWebhook prepares a receiver for outDir, first clearing temp files
+// left behind by an interrupted run and restoring its in-progress sessions.
+func NewOmiWebhook(outDir, secret string) *OmiWebhook {
+	h := &OmiWebhook{
+		OutDir: outDir,
+		Secret: secret,
+		live:   make(map[string]*omiLiveSession),
+	}
+
+	if lock, err := LockOutDir(outDir, webhookLockWait); err != nil {
+		fmt.Println("Warning:", err)
+	} else {
+		if err := h.restoreLive(); err != nil {
+			fmt.Println("Warning: restoring in-progress sessions:", err)
+		}
+		lock.Unlock()
+	}
+	return h
+}
+
+// restoreLive loads the in-progress entries a previous run left in the
+// output tree, so a restart neither orphans them nor starts a second entry
+// for the same session.
+func (h *OmiWebhook) restoreLive() error {
+	m, err := OpenManifest(h.OutDir)
+	if err != nil {
+		return err
+	}
+
+	for key, e := range m.Entries {
+		if e.SourceType != "omi" || !strings.HasPrefix(e.ID, liveIDPrefix) {
+			continue
+		}
+		path := filepath.Join(h.OutDir, filepath.FromSlash(key))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Skipping in-progress %s: %v\n", path, err)
+			continue
+		}
+		var export PendantExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			fmt.Printf("Skipping in-progress %s: %v\n", path, err)
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, export.StartTime)
+		if err != nil {
+			fmt.Printf("Skipping in-progress %s: %v\n", path, err)
+			continue
+		}
+
+		sess := &omiLiveSession{
+			uid:       export.Metadata[liveUIDKey],
+			sessionID: export.Metadata[liveSessionKey],
+			path:      path,
+			export:    &export,
+			start:     start,
+		}
+		if sess.sessionID == "" {
+			sess.sessionID = strings.TrimPrefix(export.ID, liveIDPrefix)
+		}
+		h.live[sess.uid+"/"+sess.sessionID] = sess
+	}
+	return nil
+}
+
+func (h *OmiWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 32<<20))
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+
+	var probe struct {
+		ID        string          `json:"id"`
+		SessionID string          `json:"session_id"`
+		Segments  json.RawMessage `json:"segments"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	uid := r.URL.Query().Get("uid")
+	switch {
+	case probe.Segments != nil:
+		var ev omiTranscriptEvent
+		if err := json.Unmarshal(body, &ev); err != nil {
+			http.Error(w, "Invalid transcript payload", http.StatusBadRequest)
+			return
+		}
+		if ev.SessionID == "" {
+			ev.SessionID = r.URL.Query().Get("session_id")
+		}
+		if !webhookIDRE.MatchString(ev.SessionID) {
+			http.Error(w, "Missing or invalid session_id", http.StatusBadRequest)
+			return
+		}
+		err = h.appendSegments(uid, ev)
+	case probe.ID != "":
+		var conv OmiConversation
+		if err := json.Unmarshal(body, &conv); err != nil {
+			http.Error(w, "Invalid memory payload", http.StatusBadRequest)
+			return
+		}
+		conv.Raw = body
+		sessionID := probe.SessionID
+		if sessionID == "" {
+			sessionID = r.URL.Query().Get("session_id")
+		}
+		if !webhookIDRE.MatchString(conv.ID) || (sessionID != "" && !webhookIDRE.MatchString(sessionID)) {
+			http.Error(w, "Invalid id or session_id", http.StatusBadRequest)
+			return
+		}
+		err = h.finalize(uid, sessionID, conv)
+	default:
+		http.Error(w, "Unrecognized payload", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		fmt.Println("Webhook error:", err)
+		http.Error(w, "Error saving entry", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *OmiWebhook) authorized(r *http.Request) bool {
+	got := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return h.Secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(h.Secret)) == 1
+}
+
+func (h *OmiWebhook) appendSegments(uid string, ev omiTranscriptEvent) error {
+	if ev.SessionID == "" {
+		return fmt.Errorf("transcript event without session_id")
+	}
+	if len(ev.Segments) == 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lock, err := lockOutDir(h.OutDir, webhookLockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	key := uid + "/" + ev.SessionID
+	sess, ok := h.live[key]
+	if !ok {
+		start := time.Now().In(SourceLocation("omi")).Add(-time.Duration(ev.Segments[0].Start * float64(time.Second)))
+		sess = &omiLiveSession{
+			uid:       uid,
+			sessionID: ev.SessionID,
+			start:     start,
+			export: &PendantExport{
+				ID:         liveIDPrefix + ev.SessionID,
+				SourceType: "omi",
+				StartTime:  start.Format(time.RFC3339),
+				Title:      "In progress",
+				SourceFile: "omiWebhook",
+				Metadata:   map[string]string{liveUIDKey: uid, liveSessionKey: ev.SessionID},
+			},
+		}
+		h.live[key] = sess
+	}
+
+	export := sess.export
+	for _, seg := range ev.Segments {
+		entry := ContentEntry{
+			Type:          "blockquote",
+			Content:       strings.TrimSpace(seg.Text),
+			SpeakerName:   seg.speakerName(),
+			StartTime:     sess.start.Add(time.Duration(seg.Start * float64(time.Second))).Format(time.RFC3339),
+			EndTime:       sess.start.Add(time.Duration(seg.End * float64(time.Second))).Format(time.RFC3339),
+			StartOffsetMs: int(seg.Start * 1000),
+			EndOffsetMs:   int(seg.End * 1000),
+		}
+		if seg.IsUser {
+			entry.SpeakerIdentifier = "user"
+		}
+		export.Contents = append(export.Contents, entry)
+		if export.Transcript != "" {
+			export.Transcript += "\n"
+		}
+		export.Transcript += fmt.Sprintf("%s: %s", entry.SpeakerName, entry.Content)
+		export.EndTime = entry.EndTime
+	}
+	export.ExportDate = time.Now().UTC().Format(time.RFC3339)
+	export.ExportVersion = GetVersion()
+
+	sess.path = exportPath(h.OutDir, export)
+	if err := saveExport(h.OutDir, export); err != nil {
+		return err
+	}
+	if err := updateManifest(h.OutDir, func(m *Manifest) {
+		m.addEntry(h.OutDir, sess.path, export)
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Appended %d segments to %s\n", len(ev.Segments), export.ID)
+	return nil
+}
+
+// finalize saves a finished conversation and drops the in-progress entry of
+// its session.
+func (h *OmiWebhook) finalize(uid, sessionID string, conv OmiConversation) error {
+	export := conv.ToPendantExport()
+	export.ExportDate = time.Now().UTC().Format(time.RFC3339)
+	export.ExportVersion = GetVersion()
+	export.SourceFile = "omiWebhook"
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lock, err := lockOutDir(h.OutDir, webhookLockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := saveExport(h.OutDir, export); err != nil {
+		return err
+	}
+	fmt.Println("Saved", export.ID)
+
+	var removed string
+	if key, ok := h.liveSessionFor(uid, sessionID, conv); ok {
+		sess := h.live[key]
+		if err := os.Remove(sess.path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing in-progress %s: %v\n", sess.path, err)
+		} else {
+			removed = sess.path
+		}
+		delete(h.live, key)
+	}
+
+	return updateManifest(h.OutDir, func(m *Manifest) {
+		m.addEntry(h.OutDir, exportPath(h.OutDir, export), export)
+		if removed != "" {
+			m.removeEntry(h.OutDir, removed)
+		}
+		m.synced("omi")
+	})
+}
+
+// liveSessionFor returns the key of the in-progress session conv finishes.
+// That is the session with the given ID when Omi sent one. Otherwise it is
+// the user's session that began closest to the conversation's start, within
+// the conversation's time range, so a recording still running in parallel is
+// left alone.
+func (h *OmiWebhook) liveSessionFor(uid, sessionID string, conv OmiConversation) (string, bool) {
+	if sessionID != "" {
+		key := uid + "/" + sessionID
+		_, ok := h.live[key]
+		return key, ok
+	}
+
+	start, err := time.Parse(time.RFC3339, conv.startedAt())
+	if err != nil {
+		return "", false
+	}
+	end, err := time.Parse(time.RFC3339, conv.FinishedAt)
+	if err != nil {
+		end = time.Now()
+	}
+
+	best, bestDiff := "", time.Duration(-1)
+	for key, sess := range h.live {
+		if sess.uid != uid || sess.start.Before(start.Add(-liveMatchSlack)) || sess.start.After(end) {
+			continue
+		}
+		diff := sess.start.Sub(start).Abs()
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = key, diff
+		}
+	}
+	return best, best != ""
+}
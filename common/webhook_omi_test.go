@@ -0,0 +1,238 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "s3cret"
+
+// postWebhook sends body to h and returns the status code.
+func postWebhook(t *testing.T, h http.Handler, target, body string, header map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// liveEntries lists the manifest keys of the in-progress entries in outDir.
+func liveEntries(t *testing.T, outDir string) []string {
+	t.Helper()
+	m, err := OpenManifest(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key, e := range m.Entries {
+		if strings.HasPrefix(e.ID, liveIDPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func segmentsBody(sessionID string, start float64, text string) string {
+	return fmt.Sprintf(`{"session_id":%q,"segments":[{"text":%q,"speaker":"SPEAKER_00","start":%g,"end":%g}]}`,
+		sessionID, text, start, start+2)
+}
+
+func TestOmiWebhookAuthAndRouting(t *testing.T) {
+	silenceStdout(t)
+	h := NewOmiWebhook(t.TempDir(), testWebhookSecret)
+	bearer := map[string]string{"Authorization": "Bearer " + testWebhookSecret}
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/omi?token="+testWebhookSecret, nil))
+	if get.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d, want %d", get.Code, http.StatusMethodNotAllowed)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header map[string]string
+		body   string
+		want   int
+	}{
+		{"no token", "/omi", nil, segmentsBody("a", 0, "hi"), http.StatusUnauthorized},
+		{"wrong token", "/omi?token=nope", nil, segmentsBody("a", 0, "hi"), http.StatusUnauthorized},
+		{"wrong bearer", "/omi", map[string]string{"Authorization": "Bearer nope"}, segmentsBody("a", 0, "hi"), http.StatusUnauthorized},
+		{"query token", "/omi?token=" + testWebhookSecret + "&uid=u1", nil, segmentsBody("a", 0, "hi"), http.StatusOK},
+		{"bearer token", "/omi?uid=u1", bearer, segmentsBody("b", 0, "hi"), http.StatusOK},
+		{"session id in query", "/omi?uid=u1&session_id=c", bearer, `{"segments":[{"text":"hi","start":0,"end":1}]}`, http.StatusOK},
+		{"invalid json", "/omi", bearer, `{`, http.StatusBadRequest},
+		{"unrecognized payload", "/omi", bearer, `{"hello":"world"}`, http.StatusBadRequest},
+		{"segments without session", "/omi", bearer, `{"segments":[{"text":"hi","start":0,"end":1}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postWebhook(t, h, tt.target, tt.body, tt.header); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := postWebhook(t, NewOmiWebhook(t.TempDir(), ""), "/omi?token=", segmentsBody("a", 0, "hi"), nil); got != http.StatusUnauthorized {
+		t.Errorf("empty secret: got %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestOmiWebhookAppendSurvivesRestart(t *testing.T) {
+	silenceStdout(t)
+	outDir := t.TempDir()
+	target := "/omi?uid=u1&token=" + testWebhookSecret
+
+	h := NewOmiWebhook(outDir, testWebhookSecret)
+	for i, text := range []string{"one", "two"} {
+		if got := postWebhook(t, h, target, segmentsBody("s1", float64(i*2), text), nil); got != http.StatusOK {
+			t.Fatalf("append %d: got %d", i, got)
+		}
+	}
+
+	// A new receiver stands in for a restarted listener.
+	h = NewOmiWebhook(outDir, testWebhookSecret)
+	if got := postWebhook(t, h, target, segmentsBody("s1", 4, "three"), nil); got != http.StatusOK {
+		t.Fatalf("append after restart: got %d", got)
+	}
+
+	keys := liveEntries(t, outDir)
+	if len(keys) != 1 {
+		t.Fatalf("got in-progress entries %v, want one", keys)
+	}
+	data, err := os.ReadFile(outDir + "/" + keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"one", "two", "three"} {
+		if !strings.Contains(string(data), text) {
+			t.Errorf("in-progress entry is missing segment %q", text)
+		}
+	}
+}
+
+func TestOmiWebhookFinalizeMatchesSession(t *testing.T) {
+	silenceStdout(t)
+	outDir := t.TempDir()
+	target := "/omi?uid=u1&token=" + testWebhookSecret
+	h := NewOmiWebhook(outDir, testWebhookSecret)
+
+	// s1 has been recording for ten minutes; s2 started just now, in
+	// parallel, for the same user.
+	if got := postWebhook(t, h, target, segmentsBody("s1", 600, "first"), nil); got != http.StatusOK {
+		t.Fatalf("append s1: got %d", got)
+	}
+	if got := postWebhook(t, h, target, segmentsBody("s2", 0, "second"), nil); got != http.StatusOK {
+		t.Fatalf("append s2: got %d", got)
+	}
+	if keys := liveEntries(t, outDir); len(keys) != 2 {
+		t.Fatalf("got in-progress entries %v, want two", keys)
+	}
+
+	now := time.Now().UTC()
+	memory := fmt.Sprintf(`{"id":"conv1","created_at":%q,"started_at":%q,"finished_at":%q,"structured":{"title":"Done"}}`,
+		now.Format(time.RFC3339), now.Add(-600*time.Second).Format(time.RFC3339), now.Add(-time.Minute).Format(time.RFC3339))
+	if got := postWebhook(t, h, target, memory, nil); got != http.StatusOK {
+		t.Fatalf("finalize: got %d", got)
+	}
+
+	keys := liveEntries(t, outDir)
+	if len(keys) != 1 || !strings.Contains(keys[0], "live-s2") {
+		t.Fatalf("got in-progress entries %v, want only s2", keys)
+	}
+	for _, key := range keys {
+		if _, err := os.Stat(outDir + "/" + key); err != nil {
+			t.Errorf("in-progress file of s2: %v", err)
+		}
+	}
+
+	m, err := OpenManifest(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finished bool
+	for _, e := range m.Entries {
+		finished = finished || e.ID == "conv1"
+	}
+	if !finished {
+		t.Error("finished conversation is missing from the manifest")
+	}
+
+	// With a session ID the match is exact, whatever the times say.
+	memory = fmt.Sprintf(`{"id":"conv2","session_id":"s2","created_at":%q}`, now.Add(-time.Hour).Format(time.RFC3339))
+	if got := postWebhook(t, h, target, memory, nil); got != http.StatusOK {
+		t.Fatalf("finalize s2: got %d", got)
+	}
+	if keys := liveEntries(t, outDir); len(keys) != 0 {
+		t.Errorf("got in-progress entries %v, want none", keys)
+	}
+}
+
+func TestOmiWebhookRejectsUnsafeIDs(t *testing.T) {
+	silenceStdout(t)
+	parent := t.TempDir()
+	outDir := filepath.Join(parent, "out")
+	h := NewOmiWebhook(outDir, testWebhookSecret)
+	target := "/omi?uid=u1&token=" + testWebhookSecret
+
+	for _, tt := range []struct {
+		name, target, body string
+	}{
+		{"session in body", target, segmentsBody("../../../../../escape", 0, "hi")},
+		{"session in query", target + "&session_id=..%2F..%2F..%2F..%2F..%2Fescape", `{"segments":[{"text":"hi","start":0,"end":1}]}`},
+		{"slash in session", target, segmentsBody("a/b", 0, "hi")},
+		{"conversation id", target, `{"id":"../../../../../escape","started_at":"2025-06-04T09:00:00Z","transcript_segments":[]}`},
+		{"session of conversation", target, `{"id":"conv1","session_id":"../x","started_at":"2025-06-04T09:00:00Z"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postWebhook(t, h, tt.target, tt.body, nil); got != http.StatusBadRequest {
+				t.Errorf("got %d, want %d", got, http.StatusBadRequest)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "out" {
+			t.Errorf("webhook wrote %s outside the output tree", e.Name())
+		}
+	}
+	if keys := liveEntries(t, outDir); len(keys) != 0 {
+		t.Errorf("got entries %v, want none", keys)
+	}
+}
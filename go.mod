@@ -2,10 +2,13 @@ module github.com/sottey/ainvil
 
 go 1.24.5
 
-require github.com/spf13/cobra v1.9.1
+require (
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/spf13/cobra v1.9.1
+	golang.org/x/sys v0.29.0
+)
 
 require (
-	github.com/fsnotify/fsnotify v1.8.0 // indirect
 	github.com/go-viper/mapstructure/v2 v2.2.1 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.3 // indirect
 	github.com/sagikazarmark/locafero v0.7.0 // indirect
@@ -15,7 +18,6 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.9.0 // indirect
-	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,353 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package limitlessmock_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sottey/ainvil/common"
+	"github.com/sottey/ainvil/internal/limitlessmock"
+)
+
+const apiKey = "integration-key"
+
+func TestMain(m *testing.M) {
+	// Pin the zone exports are filed in so paths do not depend on the
+	// machine running the tests.
+	if err := common.ConfigureTimezones("UTC", nil); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// startMock serves the built-in fixtures with a small page size, so every
+// sync spans several pages.
+func startMock(t *testing.T) (*limitlessmock.Server, string) {
+	t.Helper()
+	mock, err := limitlessmock.Default(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.MaxLimit = 2
+	srv := httptest.NewServer(mock)
+	t.Cleanup(srv.Close)
+	return mock, srv.URL + limitlessmock.LifelogsPath
+}
+
+func silenceStdout(t *testing.T) {
+	t.Helper()
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+// fastRetries keeps injected failures from slowing the suite down.
+var fastRetries = common.LimitlessOptions{RetryDelay: time.Millisecond}
+
+func sync(t *testing.T, url, out, start string, lopts common.LimitlessOptions) {
+	t.Helper()
+	if err := common.ParseLimitlessData(context.Background(), apiKey, url, start, out, lopts, common.ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exports returns the exports under out, keyed by path relative to out.
+func exports(t *testing.T, out string) map[string]common.PendantExport {
+	t.Helper()
+	found := map[string]common.PendantExport{}
+	err := filepath.WalkDir(out, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var e common.PendantExport
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(out, path)
+		found[filepath.ToSlash(rel)] = e
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func keys(m map[string]common.PendantExport) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func TestFullSync(t *testing.T) {
+	silenceStdout(t)
+	mock, url := startMock(t)
+	out := t.TempDir()
+
+	sync(t, url, out, "", fastRetries)
+
+	got := exports(t, out)
+	want := []string{
+		"2025/06/01/limitless_ll-0601-lunch.json",
+		"2025/06/01/limitless_ll-0601-standup.json",
+		"2025/06/02/limitless_ll-0602-call.json",
+		"2025/06/02/limitless_ll-0602-late.json",
+		"2025/06/03/limitless_ll-0603-walk.json",
+	}
+	if strings.Join(keys(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("exports = %v, want %v", keys(got), want)
+	}
+	if mock.Requests() < 3 {
+		t.Errorf("5 lifelogs at 2 per page should take 3 requests, took %d", mock.Requests())
+	}
+
+	standup := got["2025/06/01/limitless_ll-0601-standup.json"]
+	if standup.EndTime != "2025-06-01T09:15:00Z" {
+		t.Errorf("endTime = %s, want the lifelog's endTime", standup.EndTime)
+	}
+	quotes := standup.Contents[0].Children[0].Children
+	if len(quotes) != 2 || quotes[0].SpeakerIdentifier != "user" {
+		t.Errorf("nested blockquotes not kept: %+v", standup.Contents)
+	}
+	if standup.Transcript != "You: The importer is done.\nSam: Great, let's ship it." {
+		t.Errorf("transcript = %q", standup.Transcript)
+	}
+
+	lunch := got["2025/06/01/limitless_ll-0601-lunch.json"]
+	if lunch.Latitude != "47.6062" || lunch.Address != "Pike Place, Seattle" || lunch.DeviceType != "pendant" || len(lunch.Tags) != 1 {
+		t.Errorf("location, device type or tags not mapped: %+v", lunch)
+	}
+}
+
+func TestIncrementalSyncPicksUpEdits(t *testing.T) {
+	silenceStdout(t)
+	mock, url := startMock(t)
+	out := t.TempDir()
+	sync(t, url, out, "", fastRetries)
+
+	// Re-summarized a day later: same start, newer updatedAt.
+	err := mock.Put([]byte(`{"id":"ll-0603-walk","title":"Evening walk","startTime":"2025-06-03T18:00:00Z","endTime":"2025-06-03T18:40:00Z","updatedAt":"2025-06-04T07:00:00Z","contents":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last sync reached June 3, so a day's lookback refetches June 2
+	// and 3.
+	lopts := fastRetries
+	lopts.Lookback = 24 * time.Hour
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := common.ParseLimitlessData(context.Background(), apiKey, url, "", out, lopts, common.ImportOptions{PlanOutput: planPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := exports(t, out)["2025/06/03/limitless_ll-0603-walk.json"]
+	if walk.Title != "Evening walk" {
+		t.Fatalf("edited lifelog not refreshed, title %q", walk.Title)
+	}
+	history, _ := filepath.Glob(filepath.Join(out, ".ainvil", "history", "limitless", "ll-0603-walk", "*.json"))
+	if len(history) != 1 {
+		t.Fatalf("previous version not kept in history: %v", history)
+	}
+	data, err := os.ReadFile(history[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var previous common.PendantExport
+	if err := json.Unmarshal(data, &previous); err != nil || previous.Title != "Walk and talk" {
+		t.Errorf("history holds %q (%v), want the previous version", previous.Title, err)
+	}
+
+	data, err = os.ReadFile(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan common.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]common.PlanEntry{}
+	for _, e := range plan.Entries {
+		got[e.ID] = e
+	}
+	if len(got) != 3 {
+		t.Fatalf("lookback fetched %d lifelogs, want the 3 from June 2 and 3", len(got))
+	}
+	if e := got["ll-0603-walk"]; e.Action != common.ActionOverwrite {
+		t.Errorf("edited lifelog: got %s, want overwrite", e.Action)
+	}
+	for _, id := range []string{"ll-0602-call", "ll-0602-late"} {
+		if e := got[id]; e.Action != common.ActionIdentical || e.Reason != "not edited since last sync" {
+			t.Errorf("%s: got %s (%s), want it reported unchanged", id, e.Action, e.Reason)
+		}
+	}
+	if history, _ := filepath.Glob(filepath.Join(out, ".ainvil", "history", "limitless", "ll-0602-*")); len(history) != 0 {
+		t.Errorf("unedited lifelogs copied to history: %v", history)
+	}
+}
+
+func TestDateAndStarredFilters(t *testing.T) {
+	silenceStdout(t)
+	_, url := startMock(t)
+
+	out := t.TempDir()
+	lopts := fastRetries
+	lopts.Date = "2025-06-02"
+	sync(t, url, out, "", lopts)
+	if got := keys(exports(t, out)); len(got) != 2 || !strings.HasPrefix(got[0], "2025/06/02/") {
+		t.Fatalf("--date 2025-06-02 imported %v", got)
+	}
+
+	out = t.TempDir()
+	lopts = fastRetries
+	lopts.StarredOnly = true
+	sync(t, url, out, "2025-06-01", lopts)
+	got := keys(exports(t, out))
+	if len(got) != 2 || !strings.Contains(got[0], "standup") || !strings.Contains(got[1], "late") {
+		t.Fatalf("--starred-only imported %v", got)
+	}
+
+	out = t.TempDir()
+	lopts = fastRetries
+	lopts.End = "2025-06-02"
+	sync(t, url, out, "2025-06-01 12:00:00", lopts)
+	if got := keys(exports(t, out)); len(got) != 1 || !strings.Contains(got[0], "lunch") {
+		t.Fatalf("start/end range imported %v", got)
+	}
+}
+
+func TestTimezoneParameter(t *testing.T) {
+	silenceStdout(t)
+	_, url := startMock(t)
+	if err := common.ConfigureTimezones("", []string{"limitless=America/Los_Angeles"}); err != nil {
+		t.Fatal(err)
+	}
+	defer common.ConfigureTimezones("", []string{"limitless=UTC"})
+
+	// 23:30 UTC on June 2 is still June 2 in Los Angeles, 18:00 UTC on
+	// June 3 is June 3, so the Pacific June 3 holds only the walk.
+	out := t.TempDir()
+	lopts := fastRetries
+	lopts.Date = "2025-06-03"
+	sync(t, url, out, "", lopts)
+	got := keys(exports(t, out))
+	if len(got) != 1 || !strings.Contains(got[0], "walk") {
+		t.Fatalf("Pacific 2025-06-03 imported %v", got)
+	}
+}
+
+func TestRateLimitedSyncCompletes(t *testing.T) {
+	silenceStdout(t)
+	mock, url := startMock(t)
+	mock.RateLimitEvery = 2
+	mock.RetryAfter = 0
+
+	out := t.TempDir()
+	sync(t, url, out, "", fastRetries)
+	if got := len(exports(t, out)); got != 5 {
+		t.Fatalf("imported %d lifelogs through 429s, want 5", got)
+	}
+}
+
+func TestWrongAPIKey(t *testing.T) {
+	silenceStdout(t)
+	_, url := startMock(t)
+	out := t.TempDir()
+
+	err := common.ParseLimitlessData(context.Background(), "wrong", url, "", out, fastRetries, common.ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("err = %v, want unauthorized", err)
+	}
+	if got := len(exports(t, out)); got != 0 {
+		t.Fatalf("wrote %d exports without a valid key", got)
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	mock, url := startMock(t)
+	mock.MaxLimit = 10
+
+	get := func(query string) map[string]any {
+		t.Helper()
+		req, _ := http.NewRequest("GET", url+"?"+query, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: %s", query, resp.Status)
+		}
+		var body struct {
+			Data struct {
+				Lifelogs []map[string]any `json:"lifelogs"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Data.Lifelogs[0]
+	}
+
+	first := get("direction=asc&includeMarkdown=false&includeHeadings=false")
+	if first["id"] != "ll-0601-standup" {
+		t.Fatalf("asc order starts with %v", first["id"])
+	}
+	if first["markdown"] != nil {
+		t.Error("includeMarkdown=false still returned markdown")
+	}
+	contents := first["contents"].([]any)
+	if len(contents) != 2 || contents[0].(map[string]any)["type"] != "blockquote" {
+		t.Errorf("includeHeadings=false did not lift the blockquotes: %v", contents)
+	}
+
+	if get("")["id"] != "ll-0603-walk" {
+		t.Error("default order is not newest first")
+	}
+}
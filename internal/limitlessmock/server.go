@@ -0,0 +1,432 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package limitlessmock is a local stand-in for the Limitless lifelogs API.
+// It serves GET /v1/lifelogs, as described in limitless_openapi.yml, from a
+// set of fixture lifelogs, with API key checks, date range and starred
+// filtering, cursor pagination and optional 429 injection. It backs the
+// "ainvil mock-limitless" command and the Limitless integration tests.
+package limitlessmock
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LifelogsPath is the only endpoint the server answers.
+const LifelogsPath = "/v1/lifelogs"
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// Server serves lifelogs. The exported fields may be changed between
+// requests.
+type Server struct {
+	// APIKey must be sent as X-API-Key. Empty disables the check.
+	APIKey string
+	// MaxLimit caps the page size, like the real API does (default 10).
+	MaxLimit int
+	// RateLimitEvery answers every Nth request with 429 Too Many Requests.
+	// 0 disables it.
+	RateLimitEvery int
+	// RetryAfter is the Retry-After value, in seconds, sent with a 429.
+	RetryAfter int
+
+	mu       sync.Mutex
+	lifelogs map[string]lifelog
+	requests int
+}
+
+// lifelog is one fixture: the JSON object served for it and the fields the
+// server filters on.
+type lifelog struct {
+	fields  map[string]any
+	start   time.Time
+	starred bool
+}
+
+// New returns a server with no lifelogs.
+func New(apiKey string) *Server {
+	return &Server{APIKey: apiKey, MaxLimit: 10, lifelogs: map[string]lifelog{}}
+}
+
+// Default returns a server with the sample lifelogs built into ainvil.
+func Default(apiKey string) (*Server, error) {
+	sub, err := fs.Sub(fixtures, "fixtures")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(apiKey, sub)
+}
+
+// LoadDir returns a server with the lifelogs in the .json files of dir.
+func LoadDir(apiKey, dir string) (*Server, error) {
+	return LoadFS(apiKey, os.DirFS(dir))
+}
+
+// LoadFS returns a server with the lifelogs in the top level .json files of
+// fsys. A file may hold one lifelog, an array of them, or a whole API
+// response.
+func LoadFS(apiKey string, fsys fs.FS) (*Server, error) {
+	s := New(apiKey)
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Put(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return s, nil
+}
+
+// Put adds the lifelogs in data, replacing any with the same id. data may
+// hold one lifelog, an array of them, or a whole API response.
+func (s *Server) Put(data []byte) error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	var items []any
+	switch v := doc.(type) {
+	case []any:
+		items = v
+	case map[string]any:
+		if d, ok := v["data"].(map[string]any); ok {
+			items, _ = d["lifelogs"].([]any)
+		} else {
+			items = []any{v}
+		}
+	default:
+		return fmt.Errorf("expected a lifelog, an array of lifelogs or an API response")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			return fmt.Errorf("lifelog is not an object")
+		}
+		id, _ := fields["id"].(string)
+		if id == "" {
+			return fmt.Errorf("lifelog without id")
+		}
+		startStr, _ := fields["startTime"].(string)
+		start, err := time.Parse(time.RFC3339, startStr)
+		if err != nil {
+			return fmt.Errorf("lifelog %s: bad startTime: %w", id, err)
+		}
+		starred, _ := fields["isStarred"].(bool)
+		s.lifelogs[id] = lifelog{fields: fields, start: start, starred: starred}
+	}
+	return nil
+}
+
+// Len returns the number of lifelogs served.
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.lifelogs)
+}
+
+// Requests returns the number of requests received so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// query is a parsed lifelogs request.
+type query struct {
+	loc             *time.Location
+	from, to        time.Time // to is exclusive; zero means open
+	asc             bool
+	starredOnly     bool
+	includeMarkdown bool
+	includeHeadings bool
+	limit           int
+	offset          int
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	n := s.requests
+	s.mu.Unlock()
+
+	if r.URL.Path != LifelogsPath {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.APIKey != "" && r.Header.Get("X-API-Key") != s.APIKey {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if s.RateLimitEvery > 0 && n%s.RateLimitEvery == 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+		writeError(w, http.StatusTooManyRequests, "Too many requests")
+		return
+	}
+
+	q, err := s.parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	matches := s.match(q)
+	end := min(q.offset+q.limit, len(matches))
+	page := []map[string]any{}
+	if q.offset < len(matches) {
+		for _, l := range matches[q.offset:end] {
+			page = append(page, render(l, q))
+		}
+	}
+
+	var next any
+	if end < len(matches) {
+		next = encodeCursor(end)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"data": map[string]any{"lifelogs": page},
+		"meta": map[string]any{"lifelogs": map[string]any{"nextCursor": next, "count": len(page)}},
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func (s *Server) parseQuery(r *http.Request) (query, error) {
+	v := r.URL.Query()
+	q := query{loc: time.UTC, includeMarkdown: true, includeHeadings: true}
+
+	if tz := v.Get("timezone"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return q, fmt.Errorf("invalid timezone %q", tz)
+		}
+		q.loc = loc
+	}
+
+	if d := v.Get("date"); d != "" {
+		day, err := time.ParseInLocation("2006-01-02", d, q.loc)
+		if err != nil {
+			return q, fmt.Errorf("invalid date %q", d)
+		}
+		q.from, q.to = day, day.AddDate(0, 0, 1)
+	}
+	if st := v.Get("start"); st != "" {
+		t, err := parseAPITime(st, q.loc)
+		if err != nil {
+			return q, err
+		}
+		q.from = t
+	}
+	if et := v.Get("end"); et != "" {
+		t, err := parseAPITime(et, q.loc)
+		if err != nil {
+			return q, err
+		}
+		q.to = t
+	}
+
+	switch v.Get("direction") {
+	case "", "desc":
+	case "asc":
+		q.asc = true
+	default:
+		return q, fmt.Errorf("invalid direction %q", v.Get("direction"))
+	}
+
+	for name, dst := range map[string]*bool{
+		"isStarred":       &q.starredOnly,
+		"includeMarkdown": &q.includeMarkdown,
+		"includeHeadings": &q.includeHeadings,
+	} {
+		if raw := v.Get(name); raw != "" {
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*dst = b
+		}
+	}
+
+	maxLimit := s.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = 10
+	}
+	q.limit = maxLimit
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("invalid limit %q", l)
+		}
+		q.limit = min(n, maxLimit)
+	}
+
+	if c := v.Get("cursor"); c != "" {
+		offset, err := decodeCursor(c)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor")
+		}
+		q.offset = offset
+	}
+	return q, nil
+}
+
+// parseAPITime reads start and end the way the API does: YYYY-MM-DD or
+// YYYY-MM-DD HH:MM:SS in the request's timezone, with any offset ignored.
+func parseAPITime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid datetime %q", s)
+}
+
+// match returns the lifelogs q selects, in q's order.
+func (s *Server) match(q query) []lifelog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []lifelog
+	for _, l := range s.lifelogs {
+		if q.starredOnly && !l.starred {
+			continue
+		}
+		if !q.from.IsZero() && l.start.Before(q.from) {
+			continue
+		}
+		if !q.to.IsZero() && !l.start.Before(q.to) {
+			continue
+		}
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].start.Equal(out[j].start) {
+			return out[i].fields["id"].(string) < out[j].fields["id"].(string)
+		}
+		if q.asc {
+			return out[i].start.Before(out[j].start)
+		}
+		return out[i].start.After(out[j].start)
+	})
+	return out
+}
+
+// render returns the JSON object for l as q asks for it: times in q's
+// zone, and markdown or heading nodes left out if requested.
+func render(l lifelog, q query) map[string]any {
+	out := make(map[string]any, len(l.fields))
+	for k, v := range l.fields {
+		out[k] = v
+	}
+	for _, k := range []string{"startTime", "endTime"} {
+		if s, ok := out[k].(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				out[k] = t.In(q.loc).Format(time.RFC3339)
+			}
+		}
+	}
+	if !q.includeMarkdown {
+		out["markdown"] = nil
+	}
+	if !q.includeHeadings {
+		if nodes, ok := out["contents"].([]any); ok {
+			out["contents"] = dropHeadings(nodes)
+		}
+	}
+	return out
+}
+
+// dropHeadings removes heading nodes from a content tree, keeping their
+// children in their place.
+func dropHeadings(nodes []any) []any {
+	out := []any{}
+	for _, n := range nodes {
+		node, ok := n.(map[string]any)
+		if !ok {
+			continue
+		}
+		children, _ := node["children"].([]any)
+		if t, _ := node["type"].(string); strings.HasPrefix(t, "heading") {
+			out = append(out, dropHeadings(children)...)
+			continue
+		}
+		if children != nil {
+			copied := make(map[string]any, len(node))
+			for k, v := range node {
+				copied[k] = v
+			}
+			copied["children"] = dropHeadings(children)
+			node = copied
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset/" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(c string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := strings.CutPrefix(string(b), "offset/")
+	if !ok {
+		return 0, fmt.Errorf("bad cursor")
+	}
+	return strconv.Atoi(n)
+}
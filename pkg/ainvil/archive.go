@@ -0,0 +1,214 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UndatedDir holds records whose start time could not be parsed.
+const UndatedDir = "undated"
+
+const (
+	tempPrefix  = ".ainvil-"
+	tempSuffix  = ".tmp"
+	tempPattern = tempPrefix + "*" + tempSuffix
+)
+
+// Archive is an ainvil output tree: one JSON file per record at
+// YYYY/MM/DD/<sourceType>_<id>.json under Root, keyed by the record's start
+// time.
+//
+// Archive does no locking and does not maintain the manifest the CLI keeps
+// under .ainvil. When sharing a tree with the CLI, do not write while an
+// ainvil command is running, and run "ainvil reindex" afterwards.
+type Archive struct {
+	Root string
+}
+
+// Path returns where r is stored in the archive.
+func (a Archive) Path(r *Record) string {
+	name := fmt.Sprintf("%s_%s.json", r.SourceType, r.ID)
+
+	t, err := time.Parse(time.RFC3339, r.StartTime)
+	if err != nil {
+		return filepath.Join(a.Root, UndatedDir, name)
+	}
+
+	return filepath.Join(
+		a.Root,
+		fmt.Sprintf("%04d", t.Year()),
+		fmt.Sprintf("%02d", t.Month()),
+		fmt.Sprintf("%02d", t.Day()),
+		name,
+	)
+}
+
+// Write stores r at its archive path, replacing any existing file
+// atomically, and returns that path.
+func (a Archive) Write(r *Record) (string, error) {
+	data, err := Encode(r)
+	if err != nil {
+		return "", fmt.Errorf("encoding record: %w", err)
+	}
+	path := a.Path(r)
+	if err := WriteFileAtomic(path, data, 0644); err != nil {
+		return "", fmt.Errorf("writing record: %w", err)
+	}
+	return path, nil
+}
+
+// Copy writes every record src yields for [start, end] to the archive, one
+// at a time, and returns how many were written. It stops at the first error,
+// including the cancellation of ctx.
+func (a Archive) Copy(ctx context.Context, src Source, start, end time.Time) (int, error) {
+	n := 0
+	for r, err := range src.Records(ctx, start, end) {
+		if err != nil {
+			return n, err
+		}
+		if _, err := a.Write(r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Read loads the record at path. Files written by ainvil1 are converted
+// with FromLegacyEntry.
+func (a Archive) Read(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRecord(data)
+}
+
+// DecodeRecord parses an archive file, accepting both the current layout
+// and ainvil1 entries.
+func DecodeRecord(data []byte) (*Record, error) {
+	var probe struct {
+		SourceType *string          `json:"sourceType"`
+		Source     *string          `json:"source"`
+		Timestamp  *json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.SourceType == nil && probe.Source != nil && probe.Timestamp != nil {
+		var e LegacyEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		return FromLegacyEntry(e), nil
+	}
+
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.SourceType == "" {
+		return nil, fmt.Errorf("not an ainvil record: no sourceType")
+	}
+	return &r, nil
+}
+
+// Walk calls fn for every record in the archive, in lexical path order.
+// Hidden directories such as .ainvil are skipped. Returning an error from fn
+// stops the walk; files that are not valid records are passed to fn with a
+// nil record and the decode error wrapped in err.
+func (a Archive) Walk(fn func(path string, r *Record, err error) error) error {
+	return filepath.WalkDir(a.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != a.Root && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			return nil
+		}
+
+		r, err := a.Read(path)
+		if err != nil {
+			return fn(path, nil, fmt.Errorf("reading %s: %w", path, err))
+		}
+		return fn(path, r, nil)
+	})
+}
+
+// IsTempFile reports whether name is a temp file left by WriteFileAtomic.
+func IsTempFile(name string) bool {
+	return strings.HasPrefix(name, tempPrefix) && strings.HasSuffix(name, tempSuffix)
+}
+
+// WriteFileAtomic writes data to a temp file next to path, fsyncs it and
+// renames it over path, so readers only ever see the old or the new file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, tempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *Record
+		wantErr string
+	}{
+		{
+			name: "current layout",
+			data: `{"id":"abc","sourceType":"bee","startTime":"2025-06-03T19:15:00Z","title":"Dinner"}`,
+			want: &Record{ID: "abc", SourceType: "bee", StartTime: "2025-06-03T19:15:00Z", Title: "Dinner"},
+		},
+		{
+			name: "ainvil1 entry",
+			data: `{"id":"conv-1","source":"omi","timestamp":"2025-06-03T19:15:00Z","content":"Hi.","metadata":{"title":"Standup"}}`,
+			want: &Record{
+				ID: "conv-1", SourceType: "omi", StartTime: "2025-06-03T19:15:00Z", Title: "Standup",
+				Transcript: "Hi.", Metadata: map[string]string{"title": "Standup"},
+			},
+		},
+		{
+			name:    "no sourceType",
+			data:    `{"id":"abc","title":"Dinner"}`,
+			wantErr: "no sourceType",
+		},
+		{
+			name:    "source without timestamp",
+			data:    `{"id":"abc","source":"omi"}`,
+			wantErr: "no sourceType",
+		},
+		{
+			name:    "not json",
+			data:    `{"id":`,
+			wantErr: "unexpected end",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeRecord([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.Raw = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveWalk(t *testing.T) {
+	a := Archive{Root: t.TempDir()}
+	records := []*Record{
+		{ID: "b", SourceType: "bee", StartTime: "2025-06-03T19:15:00-07:00", Title: "Dinner"},
+		{ID: "a", SourceType: "omi", StartTime: "2024-01-02T09:00:00Z", Title: "Standup"},
+		{ID: "c", SourceType: "chatgpt", StartTime: "not a time"},
+	}
+	for _, r := range records {
+		if _, err := a.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extra := map[string]string{
+		"2025/06/04/omi_legacy.json":          `{"id":"legacy","source":"omi","timestamp":"2025-06-04T08:00:00Z","content":"Hi."}`,
+		"2025/06/04/broken.json":              `{`,
+		"2025/06/04/notes.txt":                `not a record`,
+		"2025/06/04/.hidden.json":             `{"id":"h","sourceType":"bee"}`,
+		".ainvil/history/bee/b/v1.json":       `{"id":"b","sourceType":"bee"}`,
+		".ainvil/state.json":                  `{}`,
+		"2025/06/04/.ainvil-omi_x.json-1.tmp": `{`,
+	}
+	for rel, data := range extra {
+		path := filepath.Join(a.Root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	var failed []string
+	err := a.Walk(func(path string, r *Record, err error) error {
+		rel, _ := filepath.Rel(a.Root, path)
+		rel = filepath.ToSlash(rel)
+		if err != nil {
+			if r != nil {
+				t.Errorf("%s: got a record with error %v", rel, err)
+			}
+			failed = append(failed, rel)
+			return nil
+		}
+		seen = append(seen, rel+" "+r.SourceType+"/"+r.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSeen := []string{
+		"2024/01/02/omi_a.json omi/a",
+		"2025/06/03/bee_b.json bee/b",
+		"2025/06/04/omi_legacy.json omi/legacy",
+		"undated/chatgpt_c.json chatgpt/c",
+	}
+	if !reflect.DeepEqual(seen, wantSeen) {
+		t.Errorf("walked %q, want %q", seen, wantSeen)
+	}
+	if want := []string{"2025/06/04/broken.json"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed %q, want %q", failed, want)
+	}
+
+	// Read gives back what Write stored.
+	r, err := a.Read(a.Path(records[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, _ := Encode(r)
+	wantJSON, _ := Encode(records[0])
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("Read: got %s, want %s", gotJSON, wantJSON)
+	}
+
+	// An error from fn stops the walk and is returned.
+	stop := errors.New("stop")
+	calls := 0
+	err = a.Walk(func(string, *Record, error) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("got %v after %d calls, want stop after 1", err, calls)
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LegacyEntry has the fields and JSON layout of ainvil1's model.Entry, so
+// entries (and the files ainvil1 wrote under export/) convert directly:
+//
+//	rec := ainvil.FromLegacyEntry(ainvil.LegacyEntry(entry))
+type LegacyEntry struct {
+	ID        string            `json:"id"`
+	Source    string            `json:"source"`
+	Timestamp time.Time         `json:"timestamp"`
+	Content   string            `json:"content"`
+	Tags      []string          `json:"tags,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// LegacyClient is ainvil1's clientiface.APIClient with LegacyEntry in place
+// of model.Entry.
+type LegacyClient interface {
+	Name() string
+	Entries(ctx context.Context, start, end time.Time) iter.Seq2[LegacyEntry, error]
+}
+
+// legacyMetadata maps the metadata keys ainvil1 clients set to the record
+// fields they describe.
+var legacyMetadata = []struct {
+	key   string
+	field func(r *Record) *string
+}{
+	{"title", func(r *Record) *string { return &r.Title }},
+	{"overview", func(r *Record) *string { return &r.Overview }},
+	{"finishedAt", func(r *Record) *string { return &r.EndTime }},
+	{"device", func(r *Record) *string { return &r.DeviceType }},
+}
+
+// FromLegacyEntry converts an ainvil1 entry. Content becomes the transcript
+// and the well known metadata keys (title, overview, finishedAt, device) also
+// fill their record fields. Metadata is kept whole, so ToLegacyEntry builds
+// an equal entry back from the record's fields. The entry's JSON is kept in
+// Raw as well.
+func FromLegacyEntry(e LegacyEntry) *Record {
+	raw, _ := json.Marshal(e)
+	r := &Record{
+		ID:         e.ID,
+		SourceType: e.Source,
+		Transcript: e.Content,
+		Tags:       slices.Clone(e.Tags),
+		Metadata:   maps.Clone(e.Metadata),
+		Raw:        raw,
+	}
+	if !e.Timestamp.IsZero() {
+		r.StartTime = e.Timestamp.Format(time.RFC3339Nano)
+	}
+	for _, m := range legacyMetadata {
+		*m.field(r) = e.Metadata[m.key]
+	}
+	return r
+}
+
+// ToLegacyEntry converts r to an ainvil1 entry. Title, overview, end time and
+// device type are added to the metadata unless it already has them.
+func ToLegacyEntry(r *Record) LegacyEntry {
+	e := LegacyEntry{
+		ID:       r.ID,
+		Source:   r.SourceType,
+		Content:  r.Transcript,
+		Tags:     slices.Clone(r.Tags),
+		Metadata: maps.Clone(r.Metadata),
+	}
+	if e.Content == "" {
+		e.Content = r.Markdown
+	}
+	if t, err := time.Parse(time.RFC3339Nano, r.StartTime); err == nil {
+		e.Timestamp = t
+	}
+	for _, m := range legacyMetadata {
+		v := *m.field(r)
+		if _, ok := e.Metadata[m.key]; ok || v == "" {
+			continue
+		}
+		if e.Metadata == nil {
+			e.Metadata = map[string]string{}
+		}
+		e.Metadata[m.key] = v
+	}
+	return e
+}
+
+// FromLegacyClient adapts an ainvil1 API client to Source.
+func FromLegacyClient(c LegacyClient) Source {
+	return legacySource{c}
+}
+
+type legacySource struct {
+	client LegacyClient
+}
+
+func (s legacySource) Name() string { return s.client.Name() }
+
+func (s legacySource) Records(ctx context.Context, start, end time.Time) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		// ainvil1 clients leave end out of the range; Records includes it.
+		if !end.IsZero() {
+			end = end.Add(time.Nanosecond)
+		}
+		for e, err := range s.client.Entries(ctx, start, end) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(FromLegacyEntry(e), nil) {
+				return
+			}
+		}
+	}
+}
+
+// DBLifelog has the fields of the Lifelog row type in tools/ainvil_to_db.
+type DBLifelog struct {
+	ID            string  `json:"id"`
+	SourceType    string  `json:"sourceType"`
+	DeviceType    string  `json:"deviceType"`
+	Title         string  `json:"title"`
+	Overview      string  `json:"overview"`
+	StartTimeRaw  string  `json:"startTime"`
+	EndTimeRaw    string  `json:"endTime"`
+	ExportDateRaw string  `json:"exportDate"`
+	Latitude      float64 `json:"latitude,string"`
+	Longitude     float64 `json:"longitude,string"`
+	Address       string  `json:"address"`
+	Transcript    string  `json:"transcript"`
+	ExportVersion string  `json:"exportVersion"`
+	FilePath      string
+	RawJSON       string
+	StartTime     time.Time
+	EndTime       time.Time
+	ExportDate    time.Time
+}
+
+// FromDBLifelog converts a database row back to a record. RawJSON holds the
+// archive file the row was imported from and is decoded when present, which
+// recovers every field; otherwise the row's columns are mapped one by one.
+// FilePath is where the record was read from and is not part of it.
+func FromDBLifelog(l DBLifelog) (*Record, error) {
+	if l.RawJSON != "" {
+		return DecodeRecord([]byte(l.RawJSON))
+	}
+
+	r := &Record{
+		ID:            l.ID,
+		SourceType:    l.SourceType,
+		DeviceType:    l.DeviceType,
+		Title:         l.Title,
+		Overview:      l.Overview,
+		StartTime:     rawOrFormat(l.StartTimeRaw, l.StartTime),
+		EndTime:       rawOrFormat(l.EndTimeRaw, l.EndTime),
+		ExportDate:    rawOrFormat(l.ExportDateRaw, l.ExportDate),
+		Address:       l.Address,
+		Transcript:    l.Transcript,
+		ExportVersion: l.ExportVersion,
+	}
+	if l.Latitude != 0 || l.Longitude != 0 {
+		r.Latitude = strconv.FormatFloat(l.Latitude, 'f', -1, 64)
+		r.Longitude = strconv.FormatFloat(l.Longitude, 'f', -1, 64)
+	}
+	return r, nil
+}
+
+// ToDBLifelog builds the database row ainvil_to_db would import from the
+// archive file at path holding r. A missing device type falls back to the
+// one in Raw and then to the source type; a missing start or end time takes
+// the other one.
+func ToDBLifelog(path string, r *Record) (DBLifelog, error) {
+	data, err := Encode(r)
+	if err != nil {
+		return DBLifelog{}, err
+	}
+
+	l := DBLifelog{
+		ID:            r.ID,
+		SourceType:    r.SourceType,
+		DeviceType:    r.DeviceType,
+		Title:         r.Title,
+		Overview:      r.Overview,
+		StartTimeRaw:  r.StartTime,
+		EndTimeRaw:    r.EndTime,
+		ExportDateRaw: r.ExportDate,
+		Address:       r.Address,
+		Transcript:    r.Transcript,
+		ExportVersion: r.ExportVersion,
+		FilePath:      path,
+		RawJSON:       string(data),
+	}
+	l.Latitude, _ = strconv.ParseFloat(r.Latitude, 64)
+	l.Longitude, _ = strconv.ParseFloat(r.Longitude, 64)
+
+	if l.DeviceType == "" {
+		var raw struct{ DeviceType string }
+		if json.Unmarshal(r.Raw, &raw) == nil {
+			l.DeviceType = raw.DeviceType
+		}
+		if l.DeviceType == "" {
+			l.DeviceType = l.SourceType
+		}
+	}
+
+	start, startOK := parseFlexibleTime(r.StartTime)
+	end, endOK := parseFlexibleTime(r.EndTime)
+	switch {
+	case !startOK && endOK:
+		start = end
+	case startOK && !endOK:
+		end = start
+	}
+	l.StartTime, l.EndTime = start, end
+	l.ExportDate, _ = parseFlexibleTime(r.ExportDate)
+	return l, nil
+}
+
+// parseFlexibleTime accepts the RFC3339 times ainvil writes and bare dates.
+func parseFlexibleTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func rawOrFormat(raw string, t time.Time) string {
+	if raw != "" || t.IsZero() {
+		return raw
+	}
+	return t.Format(time.RFC3339)
+}
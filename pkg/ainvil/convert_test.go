@@ -0,0 +1,252 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func legacyFixture() LegacyEntry {
+	return LegacyEntry{
+		ID:        "conv-1",
+		Source:    "omi",
+		Timestamp: time.Date(2025, 6, 3, 19, 15, 30, 500, time.UTC),
+		Content:   "Speaker 0: Morning all.",
+		Tags:      []string{"work"},
+		Metadata: map[string]string{
+			"title":      "Standup",
+			"overview":   "Daily standup.",
+			"finishedAt": "2025-06-03T19:45:00Z",
+			"device":     "Omi",
+			"language":   "en",
+		},
+	}
+}
+
+func TestLegacyEntryRoundTrip(t *testing.T) {
+	e := legacyFixture()
+	r := FromLegacyEntry(e)
+
+	want := Record{
+		ID:         "conv-1",
+		SourceType: "omi",
+		StartTime:  "2025-06-03T19:15:30.0000005Z",
+		EndTime:    "2025-06-03T19:45:00Z",
+		Title:      "Standup",
+		Overview:   "Daily standup.",
+		Transcript: "Speaker 0: Morning all.",
+		DeviceType: "Omi",
+		Tags:       []string{"work"},
+		Metadata:   e.Metadata,
+	}
+	got := *r
+	got.Raw = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FromLegacyEntry:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	var raw LegacyEntry
+	if err := json.Unmarshal(r.Raw, &raw); err != nil || !reflect.DeepEqual(raw, e) {
+		t.Errorf("Raw: got %+v (%v), want the entry", raw, err)
+	}
+
+	if back := ToLegacyEntry(r); !reflect.DeepEqual(back, e) {
+		t.Errorf("ToLegacyEntry:\ngot  %+v\nwant %+v", back, e)
+	}
+
+	// The record owns copies of the entry's slices and maps.
+	r.Metadata["title"] = "Changed"
+	r.Tags[0] = "changed"
+	if e.Metadata["title"] != "Standup" || e.Tags[0] != "work" {
+		t.Error("FromLegacyEntry shares metadata or tags with the entry")
+	}
+}
+
+func TestToLegacyEntryFromRecord(t *testing.T) {
+	r := &Record{
+		ID:         "abc",
+		SourceType: "limitless",
+		StartTime:  "2025-06-03T19:15:00-07:00",
+		Title:      "Lunch",
+		Markdown:   "# Lunch",
+		DeviceType: "Pendant",
+		Metadata:   map[string]string{"title": "Kept"},
+	}
+	e := ToLegacyEntry(r)
+
+	if e.Content != "# Lunch" {
+		t.Errorf("Content: got %q, want the markdown when there is no transcript", e.Content)
+	}
+	if !e.Timestamp.Equal(time.Date(2025, 6, 4, 2, 15, 0, 0, time.UTC)) {
+		t.Errorf("Timestamp: got %v", e.Timestamp)
+	}
+	wantMeta := map[string]string{"title": "Kept", "device": "Pendant"}
+	if !reflect.DeepEqual(e.Metadata, wantMeta) {
+		t.Errorf("Metadata: got %v, want %v", e.Metadata, wantMeta)
+	}
+	if r.Metadata["device"] != "" {
+		t.Error("ToLegacyEntry changed the record's metadata")
+	}
+}
+
+// legacyClient serves entries the way an ainvil1 client does, from start up
+// to but not including end.
+type legacyClient []LegacyEntry
+
+func (legacyClient) Name() string { return "omi" }
+
+func (c legacyClient) Entries(ctx context.Context, start, end time.Time) iter.Seq2[LegacyEntry, error] {
+	return func(yield func(LegacyEntry, error) bool) {
+		for _, e := range c {
+			if err := ctx.Err(); err != nil {
+				yield(LegacyEntry{}, err)
+				return
+			}
+			if e.Timestamp.Before(start) || (!end.IsZero() && !e.Timestamp.Before(end)) {
+				continue
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestFromLegacyClient(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 9, 0, 0, 0, time.UTC) }
+	client := legacyClient{
+		{ID: "a", Source: "omi", Timestamp: day(1)},
+		{ID: "b", Source: "omi", Timestamp: day(2)},
+		{ID: "c", Source: "omi", Timestamp: day(3)},
+	}
+	src := FromLegacyClient(client)
+
+	records, err := Collect(src.Records(context.Background(), day(2), day(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != "b" || records[1].ID != "c" {
+		t.Errorf("got %+v, want b and c with the end included", records)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Collect(src.Records(ctx, time.Time{}, time.Time{})); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestDBLifelogRoundTrip(t *testing.T) {
+	r := &Record{
+		ID:            "abc",
+		SourceType:    "bee",
+		StartTime:     "2025-06-03T19:15:00-07:00",
+		EndTime:       "2025-06-03T19:45:00-07:00",
+		Title:         "Dinner",
+		Overview:      "Talked about dinner.",
+		Transcript:    "Speaker 1: Tacos.",
+		Contents:      []Content{{Type: "blockquote", Content: "Tacos.", SpeakerName: "Speaker 1"}},
+		ExportDate:    "2025-06-04T00:00:00Z",
+		ExportVersion: "Ainvil 2.1.0",
+		SourceFile:    "/exports/bee.txt",
+		DeviceType:    "Bee",
+		Latitude:      "47.6",
+		Longitude:     "-122.3",
+		Address:       "1 Main St",
+		Raw:           json.RawMessage(`{"DeviceType":"Bee"}`),
+	}
+
+	l, err := ToDBLifelog("/out/2025/06/03/bee_abc.json", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.FilePath != "/out/2025/06/03/bee_abc.json" || l.Latitude != 47.6 || l.Longitude != -122.3 {
+		t.Errorf("row: got path %q, lat %v, lon %v", l.FilePath, l.Latitude, l.Longitude)
+	}
+	if want := time.Date(2025, 6, 4, 2, 15, 0, 0, time.UTC); !l.StartTime.Equal(want) {
+		t.Errorf("StartTime: got %v, want %v", l.StartTime, want)
+	}
+
+	back, err := FromDBLifelog(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Raw is re-indented on the way, so compare the encoded records.
+	gotJSON, _ := Encode(back)
+	wantJSON, _ := Encode(r)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("FromDBLifelog(ToDBLifelog(r)):\ngot  %s\nwant %s", gotJSON, wantJSON)
+	}
+
+	// Without RawJSON the columns are mapped one by one.
+	l.RawJSON = ""
+	cols, err := FromDBLifelog(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := *r
+	want.Contents, want.SourceFile, want.Raw = nil, "", nil
+	if !reflect.DeepEqual(*cols, want) {
+		t.Errorf("FromDBLifelog by columns:\ngot  %+v\nwant %+v", *cols, want)
+	}
+}
+
+func TestToDBLifelogFallbacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		r          Record
+		device     string
+		start, end time.Time
+	}{
+		{
+			name:   "device from raw",
+			r:      Record{SourceType: "bee", StartTime: "2025-06-03T10:00:00Z", Raw: json.RawMessage(`{"DeviceType":"Bee Pioneer"}`)},
+			device: "Bee Pioneer",
+			start:  time.Date(2025, 6, 3, 10, 0, 0, 0, time.UTC),
+			end:    time.Date(2025, 6, 3, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "device from source type, start from end",
+			r:      Record{SourceType: "omi", StartTime: "yesterday", EndTime: "2025-06-03"},
+			device: "omi",
+			start:  time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		l, err := ToDBLifelog("x.json", &tt.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.DeviceType != tt.device || !l.StartTime.Equal(tt.start) || !l.EndTime.Equal(tt.end) {
+			t.Errorf("%s: got device %q, %v - %v, want %q, %v - %v",
+				tt.name, l.DeviceType, l.StartTime, l.EndTime, tt.device, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errStopWalk ends a walk early once the consumer stops iterating.
+var errStopWalk = errors.New("stop walk")
+
+// DirSource streams the export files below a folder through the registered
+// file sources. Hidden files and folders are skipped, as are files no file
+// source recognizes. A file that fails to parse yields an error and the
+// iteration carries on with the next file.
+type DirSource struct {
+	Root string
+}
+
+func (d DirSource) Name() string { return "files" }
+
+func (d DirSource) Records(ctx context.Context, start, end time.Time) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		err := filepath.WalkDir(d.Root, func(path string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if strings.HasPrefix(e.Name(), ".") && path != d.Root {
+				if e.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !e.Type().IsRegular() {
+				return nil
+			}
+
+			src, err := DetectFileSource(path)
+			if err != nil {
+				return nil
+			}
+			r, err := src.Parse(path)
+			if err != nil {
+				if !yield(nil, fmt.Errorf("%s: %w", path, err)) {
+					return errStopWalk
+				}
+				return nil
+			}
+			if InRange(r, start, end) && !yield(r, nil) {
+				return errStopWalk
+			}
+			return nil
+		})
+		if err != nil && err != errStopWalk {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// noteSource reads ".note" files whose first line is "NOTE <RFC 3339 start>".
+// A start that does not parse is a parse error.
+type noteSource struct{}
+
+func (noteSource) Name() string         { return "note" }
+func (noteSource) Extensions() []string { return []string{".note"} }
+func (noteSource) Sniff(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("NOTE "))
+}
+
+func (noteSource) Parse(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	line, _, _ := strings.Cut(strings.TrimPrefix(string(data), "NOTE "), "\n")
+	if _, err := time.Parse(time.RFC3339, line); err != nil {
+		return nil, fmt.Errorf("bad start time %q", line)
+	}
+	return &Record{ID: strings.TrimSuffix(filepath.Base(path), ".note"), SourceType: "note", StartTime: line, SourceFile: path}, nil
+}
+
+var registerNotes sync.Once
+
+// writeNotes registers noteSource and writes files, a map of slash paths
+// below a new temporary folder to contents, returning the folder.
+func writeNotes(t *testing.T, files map[string]string) string {
+	t.Helper()
+	registerNotes.Do(func() { RegisterFileSource(noteSource{}) })
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDirSource(t *testing.T) {
+	root := writeNotes(t, map[string]string{
+		"a.note":            "NOTE 2025-06-01T10:00:00Z\n",
+		"june/b.note":       "NOTE 2025-06-15T10:00:00Z\n",
+		"june/late/c.note":  "NOTE 2025-07-02T10:00:00Z\n",
+		"june/broken.note":  "NOTE yesterday\n",
+		"june/readme.txt":   "NOTE 2025-06-20T10:00:00Z\n",
+		"june/other.note":   "not a note\n",
+		".ainvil/d.note":    "NOTE 2025-06-16T10:00:00Z\n",
+		"june/.hidden.note": "NOTE 2025-06-17T10:00:00Z\n",
+		"undated/e.note":    "NOTE 2025-06-18T10:00:00Z\n",
+	})
+	src := DirSource{Root: root}
+
+	var ids, errs []string
+	for r, err := range src.Records(context.Background(), time.Time{}, time.Time{}) {
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		ids = append(ids, r.ID)
+	}
+	slices.Sort(ids)
+	if got := strings.Join(ids, " "); got != "a b c e" {
+		t.Errorf("got records %s", got)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0], "broken.note") || !strings.Contains(errs[0], "bad start time") {
+		t.Errorf("got errors %q, want one naming broken.note", errs)
+	}
+
+	t.Run("range", func(t *testing.T) {
+		start := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+		end := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+		var ids []string
+		for r, err := range src.Records(context.Background(), start, end) {
+			if err == nil {
+				ids = append(ids, r.ID)
+			}
+		}
+		slices.Sort(ids)
+		if got := strings.Join(ids, " "); got != "b e" {
+			t.Errorf("got records %s", got)
+		}
+	})
+
+	t.Run("consumer stops", func(t *testing.T) {
+		n := 0
+		for range src.Records(context.Background(), time.Time{}, time.Time{}) {
+			n++
+			break
+		}
+		if n != 1 {
+			t.Errorf("iterated %d times after break", n)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var records int
+		var last error
+		for r, err := range src.Records(ctx, time.Time{}, time.Time{}) {
+			if err != nil {
+				last = err
+				continue
+			}
+			if r != nil {
+				records++
+				cancel()
+			}
+		}
+		if records != 1 || !errors.Is(last, context.Canceled) {
+			t.Errorf("got %d records and %v after cancelling on the first", records, last)
+		}
+	})
+
+	t.Run("missing folder", func(t *testing.T) {
+		_, err := Collect(DirSource{Root: filepath.Join(root, "gone")}.Records(context.Background(), time.Time{}, time.Time{}))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("got %v, want a not-exist error", err)
+		}
+	})
+}
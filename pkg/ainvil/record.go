@@ -0,0 +1,96 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package ainvil is the public Go SDK for ainvil archives. It defines the
+// canonical Record every source is converted to, the interfaces API and file
+// sources implement, an Archive type for reading and writing the
+// YYYY/MM/DD output tree, and converters from the older ainvil1 Entry and
+// ainvil_to_db Lifelog types.
+//
+// The built-in sources live in the common package and register themselves
+// here when it is imported:
+//
+//	import (
+//		"github.com/sottey/ainvil/pkg/ainvil"
+//		_ "github.com/sottey/ainvil/common"
+//	)
+package ainvil
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Record is one lifelog, conversation or transcript as stored in the
+// archive. Times are RFC3339 strings so that values a source could not parse
+// survive unchanged.
+type Record struct {
+	ID            string            `json:"id"`
+	SourceType    string            `json:"sourceType"`
+	StartTime     string            `json:"startTime"`
+	EndTime       string            `json:"endTime"`
+	Title         string            `json:"title"`
+	Overview      string            `json:"overview"`
+	Transcript    string            `json:"transcript"`
+	Contents      []Content         `json:"contents"`
+	Markdown      string            `json:"markdown,omitempty"`
+	IsStarred     bool              `json:"isStarred,omitempty"`
+	UpdatedAt     string            `json:"updatedAt,omitempty"`
+	CreatedAt     string            `json:"createdAt,omitempty"`
+	ExportDate    string            `json:"exportDate"`
+	ExportVersion string            `json:"exportVersion"`
+	SourceFile    string            `json:"sourceFile"`
+	DeviceType    string            `json:"deviceType,omitempty"`
+	Latitude      string            `json:"latitude,omitempty"`
+	Longitude     string            `json:"longitude,omitempty"`
+	Address       string            `json:"address,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	TimeError     string            `json:"timeError,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Raw           json.RawMessage   `json:"raw"`
+}
+
+// Content is one node of a record's structured contents: a heading, a
+// paragraph or a transcript line, optionally with nested children.
+type Content struct {
+	Type    string `json:"type"`
+	Content string `json:"content"`
+
+	SpeakerName       string `json:"speakerName,omitempty"`
+	SpeakerIdentifier string `json:"speakerIdentifier,omitempty"`
+	StartTime         string `json:"startTime,omitempty"`
+	EndTime           string `json:"endTime,omitempty"`
+	StartOffsetMs     int    `json:"startOffsetMs,omitempty"`
+	EndOffsetMs       int    `json:"endOffsetMs,omitempty"`
+
+	Children []Content `json:"children,omitempty"`
+}
+
+// Encode returns r as the indented JSON written to the archive.
+func Encode(r *Record) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2025 sottey
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package ainvil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SniffSize is how many leading bytes of a file are handed to
+// FileSource.Sniff.
+const SniffSize = 4096
+
+// FileSource is a file based export format such as a Bee or Omi text export.
+type FileSource interface {
+	// Name is the source type written to Record.SourceType.
+	Name() string
+	// Extensions limits the source to files with these extensions, such as
+	// ".txt". Empty means any file.
+	Extensions() []string
+	// Sniff reports whether the first SniffSize bytes of a file look like
+	// this format.
+	Sniff(head []byte) bool
+	// Parse turns the file at path into a record.
+	Parse(path string) (*Record, error)
+}
+
+// Source streams records from a service or a folder of exports. Records
+// yields each record as soon as it is read, so a backfill over years holds
+// one page in memory at a time. An error is yielded with a nil record; the
+// iteration ends after it unless the source says otherwise. Cancelling ctx
+// stops the iteration with ctx.Err().
+type Source interface {
+	// Name is the source type written to Record.SourceType.
+	Name() string
+	// Records yields the records that started inside [start, end]. A zero
+	// start or end leaves that side of the range open.
+	Records(ctx context.Context, start, end time.Time) iter.Seq2[*Record, error]
+}
+
+// SourceFactory builds a Source for the given credentials. An empty baseURL
+// selects the service's public endpoint.
+type SourceFactory func(token, baseURL string) Source
+
+var (
+	mu          sync.RWMutex
+	fileSources []FileSource
+	apiSources  = map[string]SourceFactory{}
+)
+
+// RegisterFileSource adds a file source to the registry. Sources are tried
+// in the order they were registered by DetectFileSource. It panics if the
+// name is taken; see AddFileSource.
+func RegisterFileSource(s FileSource) {
+	if err := AddFileSource(s); err != nil {
+		panic("ainvil: " + err.Error())
+	}
+}
+
+// AddFileSource is RegisterFileSource for sources that are not known at
+// compile time. It returns an error if a source with the same name, ignoring
+// case, is already registered.
+func AddFileSource(s FileSource) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, existing := range fileSources {
+		if strings.EqualFold(existing.Name(), s.Name()) {
+			return fmt.Errorf("file source %q is already registered", s.Name())
+		}
+	}
+	fileSources = append(fileSources, s)
+	return nil
+}
+
+// FileSources returns the registered file sources in registration order.
+func FileSources() []FileSource {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]FileSource(nil), fileSources...)
+}
+
+// LookupFileSource returns the registered file source with the given name.
+func LookupFileSource(name string) (FileSource, bool) {
+	for _, s := range FileSources() {
+		if strings.EqualFold(s.Name(), name) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// DetectFileSource returns the first registered file source that takes the
+// extension of path and whose Sniff accepts the start of the file.
+func DetectFileSource(path string) (FileSource, error) {
+	head, err := ReadHead(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range FileSources() {
+		if HasExtension(path, s.Extensions()) && s.Sniff(head) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized format")
+}
+
+// HasExtension reports whether path ends in one of exts, ignoring case. An
+// empty exts matches every path.
+func HasExtension(path string, exts []string) bool {
+	if len(exts) == 0 {
+		return true
+	}
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadHead returns up to SniffSize leading bytes of the file at path.
+func ReadHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %v", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, SniffSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("reading file: %v", err)
+	}
+	return head[:n], nil
+}
+
+// RegisterSource makes an API source available to NewSource under name.
+func RegisterSource(name string, factory SourceFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := apiSources[key]; ok {
+		panic("ainvil: source " + name + " registered twice")
+	}
+	apiSources[key] = factory
+}
+
+// NewSource builds the registered API source called name.
+func NewSource(name, token, baseURL string) (Source, error) {
+	mu.RLock()
+	factory, ok := apiSources[strings.ToLower(name)]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q", name)
+	}
+	return factory(token, baseURL), nil
+}
+
+// Sources returns the names of the registered API sources, sorted.
+func Sources() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(apiSources))
+	for name := range apiSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Collect drains records into a slice, stopping at the first error.
+func Collect(records iter.Seq2[*Record, error]) ([]*Record, error) {
+	var all []*Record
+	for r, err := range records {
+		if err != nil {
+			return all, err
+		}
+		all = append(all, r)
+	}
+	return all, nil
+}
+
+// InRange reports whether the record started inside [start, end]. Records
+// whose start time cannot be parsed are always in range, so they are not
+// lost silently.
+func InRange(r *Record, start, end time.Time) bool {
+	t, err := time.Parse(time.RFC3339, r.StartTime)
+	if err != nil {
+		return true
+	}
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || !t.After(end))
+}